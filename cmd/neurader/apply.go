@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"neurader/internal/modules"
+	"neurader/internal/playbook"
+	"neurader/internal/ssh"
+)
+
+func cmdApply(argv []string) {
+	fs := newFlagSet("apply")
+	opts := runFlags(fs)
+	check := fs.Bool("check", false, "report what module tasks would change without changing anything; command tasks are skipped")
+	diff := fs.Bool("diff", false, "show a diff of each change to file contents, packages and services")
+	args, _ := parseArgs(fs, argv)
+	if len(args) != 1 {
+		fmt.Println("Usage: neurader apply [flags] <playbook.yml>")
+		fs.PrintDefaults()
+		return
+	}
+	rejectCapture(opts, "apply")
+	if opts.Output == "json" {
+		fmt.Println("[!] apply supports --output stream, grouped or summary")
+		os.Exit(2)
+	}
+
+	plays, err := playbook.Load(args[0])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	out, err := ssh.NewOutput(opts.Output)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	report, err := playbook.Apply(ctx, plays, *opts, modules.Options{Check: *check, Diff: *diff}, out)
+	report.Print()
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	if len(report.FailedHosts()) > 0 || ctx.Err() != nil {
+		os.Exit(1)
+	}
+}
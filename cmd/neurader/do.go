@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"neurader/internal/modules"
+)
+
+func cmdDo(argv []string) {
+	fs := newFlagSet("do")
+	opts := runFlags(fs)
+	check := fs.Bool("check", false, "report what would change without changing anything")
+	diff := fs.Bool("diff", false, "show a diff of each change to file contents, packages and services")
+	noTemplate := fs.Bool("no-template", false, "send argument values verbatim without template rendering")
+	args, _ := parseArgs(fs, argv)
+	if len(args) < 2 {
+		fmt.Println("Usage: neurader do [flags] <module> [key=value...] <Alias/IP/@group>")
+		printModules()
+		return
+	}
+	opts.Templated = !*noTemplate
+
+	// Everything but the targets is key=value.
+	var words []string
+	targets := ""
+	for _, a := range args[1:] {
+		if strings.Contains(a, "=") {
+			words = append(words, a)
+			continue
+		}
+		if targets != "" {
+			fmt.Printf("[!] Unexpected argument %q (arguments are key=value, targets are comma-separated)\n", a)
+			os.Exit(2)
+		}
+		targets = a
+	}
+	if targets == "" {
+		fmt.Println("[!] No targets given.")
+		os.Exit(2)
+	}
+	margs, err := modules.ParseArgs(words)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	exitForResults(modules.Run(ctx, splitTargets(targets), args[0], margs, modules.Options{Check: *check, Diff: *diff}, *opts))
+}
+
+func printModules() {
+	fmt.Println("\nModules:")
+	for _, name := range modules.Names() {
+		m, _ := modules.Lookup(name)
+		fmt.Printf("  %-11s %s\n", m.Name, m.Summary)
+		for _, p := range m.Params {
+			desc := p.Help
+			switch {
+			case p.Required:
+				desc = strings.TrimSpace("(required) " + desc)
+			case len(p.Choices) > 0:
+				desc = strings.TrimSpace(strings.Join(p.Choices, "|") + " " + desc)
+			}
+			if p.Default != "" {
+				desc += fmt.Sprintf(" [default %s]", p.Default)
+			}
+			fmt.Println(strings.TrimRight(fmt.Sprintf("      %-13s %s", p.Name, strings.TrimSpace(desc)), " "))
+		}
+	}
+}
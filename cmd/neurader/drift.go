@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"neurader/internal/drift"
+	"neurader/internal/ssh"
+)
+
+// driftFlags registers the collection flags shared by "drift" and
+// "drift baseline save". The returned function applies the flags that
+// were given to a starting spec.
+func driftFlags(fs *flag.FlagSet) (name *string, spec func(drift.Spec) drift.Spec) {
+	files := fs.String("files", "", "comma-separated absolute paths of files to checksum")
+	noPackages := fs.Bool("no-packages", false, "don't collect installed package versions")
+	noServices := fs.Bool("no-services", false, "don't collect enabled services")
+	name = fs.String("baseline", "", "baseline name (default: derived from the targets, e.g. @web -> web)")
+	return name, func(s drift.Spec) drift.Spec {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "files":
+				s.Files = nil
+				for _, path := range strings.Split(*files, ",") {
+					if path = strings.TrimSpace(path); path != "" {
+						s.Files = append(s.Files, path)
+					}
+				}
+			case "no-packages":
+				s.Packages = !*noPackages
+			case "no-services":
+				s.Services = !*noServices
+			}
+		})
+		return s
+	}
+}
+
+// defaultSpec is what drift collects when there is no baseline to follow.
+var defaultSpec = drift.Spec{Packages: true, Services: true}
+
+func baselineName(name string, targets []string) string {
+	if name == "" {
+		name = drift.DefaultName(targets)
+	}
+	if !drift.ValidName(name) {
+		fmt.Printf("[!] Invalid baseline name %q: use letters, digits, '.', '_' and '-'\n", name)
+		os.Exit(2)
+	}
+	return name
+}
+
+func cmdDrift(argv []string) {
+	if len(argv) > 0 && argv[0] == "baseline" {
+		if len(argv) < 2 || argv[1] != "save" {
+			fmt.Println("Usage: neurader drift baseline save [flags] <Alias/IP/@group>")
+			os.Exit(2)
+		}
+		cmdDriftBaselineSave(argv[2:])
+		return
+	}
+
+	fs := newFlagSet("drift")
+	opts := runFlags(fs)
+	nameFlag, specFlags := driftFlags(fs)
+	args, _ := parseArgs(fs, argv)
+	if len(args) != 1 {
+		fmt.Println("Usage: neurader drift [flags] <Alias/IP/@group>")
+		fmt.Println("       neurader drift baseline save [flags] <Alias/IP/@group>")
+		fs.PrintDefaults()
+		return
+	}
+	targets := splitTargets(args[0])
+	name := baselineName(*nameFlag, targets)
+
+	base, err := drift.LoadBaseline(name)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	// Collect what the baseline has, so everything compares, unless the
+	// flags say otherwise.
+	spec := defaultSpec
+	if base != nil {
+		spec = base.Spec
+	}
+	spec = specFlags(spec)
+
+	ctx, stop := interruptContext()
+	defer stop()
+	snap, failed, err := drift.Collect(ctx, targets, spec, *opts)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	if ctx.Err() != nil {
+		os.Exit(1)
+	}
+
+	drifted := drift.PrintOutliers(snap, drift.Outliers(snap))
+	if base != nil {
+		changes, added, missing := drift.Changes(base, snap)
+		drifted = drift.PrintChanges(base, changes, added, missing) || drifted
+	} else {
+		fmt.Printf("[~] No baseline %q yet: save one with \"neurader drift baseline save %s\".\n", name, args[0])
+	}
+	if drifted || len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func cmdDriftBaselineSave(argv []string) {
+	fs := newFlagSet("drift baseline save")
+	opts := runFlags(fs)
+	nameFlag, specFlags := driftFlags(fs)
+	args, _ := parseArgs(fs, argv)
+	if len(args) != 1 {
+		fmt.Println("Usage: neurader drift baseline save [flags] <Alias/IP/@group>")
+		fs.PrintDefaults()
+		return
+	}
+	targets := splitTargets(args[0])
+	name := baselineName(*nameFlag, targets)
+	spec := specFlags(defaultSpec)
+
+	ctx, stop := interruptContext()
+	defer stop()
+	snap, failed, err := drift.Collect(ctx, targets, spec, *opts)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	if ctx.Err() != nil {
+		fmt.Println("[!] Interrupted: baseline not saved.")
+		os.Exit(1)
+	}
+	if len(snap.Hosts) == 0 {
+		fmt.Println("[!] No host could be collected: baseline not saved.")
+		os.Exit(1)
+	}
+
+	snap.Name = name
+	path, err := drift.SaveBaseline(snap)
+	if err != nil {
+		fmt.Printf("[!] Could not save baseline: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Printf("%s[+] Baseline %q saved to %s: %d host(s).%s\n", ssh.ColorGreen, name, path, len(snap.Hosts), ssh.ColorReset)
+	if len(failed) > 0 {
+		fmt.Printf("[!] %d host(s) could not be collected and are not in the baseline.\n", len(failed))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// parseArgs parses fs against args while allowing flags to appear before,
+// between or after positional arguments (Go's flag package stops at the
+// first positional). Everything after a bare "--" is returned untouched as
+// passthrough.
+func parseArgs(fs *flag.FlagSet, args []string) (positional, passthrough []string) {
+	for i, a := range args {
+		if a == "--" {
+			passthrough = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+
+	for {
+		_ = fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return positional, passthrough
+}
+
+// splitTargets turns "web1,web2,@db" into its individual targets.
+func splitTargets(arg string) []string {
+	return strings.Split(arg, ",")
+}
+
+// absPathFlag stores a path made absolute, so it still means the same
+// directory when a job hands it to the daemon.
+type absPathFlag struct{ p *string }
+
+func (f absPathFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return *f.p
+}
+
+func (f absPathFlag) Set(s string) error {
+	abs, err := filepath.Abs(s)
+	if err != nil {
+		return err
+	}
+	*f.p = abs
+	return nil
+}
+
+// byteSizeFlag parses sizes such as 512, 64K, 10M or 1G (powers of 1024).
+type byteSizeFlag struct{ n *int64 }
+
+func (f byteSizeFlag) String() string {
+	if f.n == nil || *f.n == 0 {
+		return "0"
+	}
+	return strconv.FormatInt(*f.n, 10)
+}
+
+func (f byteSizeFlag) Set(s string) error {
+	num := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if i := strings.IndexAny(num, "KMG"); i >= 0 && i == len(num)-1 {
+		mult = map[byte]int64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30}[num[i]]
+		num = num[:i]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mult {
+		return fmt.Errorf("invalid size %q (e.g. 512K, 10M)", s)
+	}
+	*f.n = n * mult
+	return nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
+
+// interruptContext is cancelled on the first Ctrl-C or SIGTERM so remote
+// commands can be signalled and cleaned up. Default handling is restored
+// afterwards, so a second Ctrl-C force-quits.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			signal.Stop(sigs)
+			fmt.Fprintln(os.Stderr, "\n[!] Interrupt received: signalling remote commands (Ctrl-C again to force quit)...")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
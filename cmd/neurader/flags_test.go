@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestByteSizeFlag(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"64K", 64 << 10},
+		{"64k", 64 << 10},
+		{"64KB", 64 << 10},
+		{"10M", 10 << 20},
+		{" 1G ", 1 << 30},
+	}
+	for _, tt := range tests {
+		var n int64
+		if err := (byteSizeFlag{&n}).Set(tt.in); err != nil {
+			t.Errorf("Set(%q): %v", tt.in, err)
+			continue
+		}
+		if n != tt.want {
+			t.Errorf("Set(%q) = %d, want %d", tt.in, n, tt.want)
+		}
+	}
+}
+
+func TestByteSizeFlagInvalid(t *testing.T) {
+	for _, in := range []string{"", "K", "-1", "1.5M", "10T", "M10", "1KM", "9999999999G"} {
+		var n int64
+		if err := (byteSizeFlag{&n}).Set(in); err == nil {
+			t.Errorf("Set(%q) = %d, expected an error", in, n)
+		}
+	}
+}
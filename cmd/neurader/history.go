@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"neurader/internal/history"
+	"neurader/internal/ssh"
+)
+
+// recordRun stores a finished run in history and, if hosts failed, says
+// how to retry them.
+func recordRun(targets []string, command string, opts ssh.RunOptions, rerunOf int, started time.Time, results []ssh.Result, runErr error) {
+	e := history.Entry{Command: command, Targets: targets, Options: opts, RerunOf: rerunOf, Started: started}
+	id, err := history.Record(e, results, runErr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] Could not record the run in history: %v\n", err)
+		return
+	}
+	if runErr == nil && ssh.AnyFailed(results) && opts.Output != "json" {
+		fmt.Printf("[~] Recorded as run %d. Retry the failed hosts with: neurader rerun %d --failed-only\n", id, id)
+	}
+}
+
+func cmdHistory(argv []string) {
+	fs := newFlagSet("history")
+	limit := fs.Int("n", 20, "number of runs to list (0 = all)")
+	args, _ := parseArgs(fs, argv)
+	if len(args) == 0 {
+		history.PrintList(history.List(*limit))
+		return
+	}
+	e, err := history.Find(args[0])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	history.PrintEntry(e)
+}
+
+func cmdRerun(argv []string) {
+	fs := newFlagSet("rerun")
+	failedOnly := fs.Bool("failed-only", false, "run only on the hosts that failed")
+	hosts := fs.String("hosts", "", "run on these targets instead, e.g. web1,@db")
+	// The original run's capture directory is not reused: its files and
+	// manifest would be overwritten.
+	var capture ssh.Capture
+	captureFlags(fs, &capture)
+	args, _ := parseArgs(fs, argv)
+	if len(args) != 1 {
+		fmt.Println("Usage: neurader rerun [--output-dir <dir>] <id> [--failed-only | --hosts <Alias/IP/@group>]")
+		fs.PrintDefaults()
+		return
+	}
+	if *failedOnly && *hosts != "" {
+		fmt.Println("[!] --failed-only and --hosts can't be combined.")
+		os.Exit(2)
+	}
+	e, err := history.Find(args[0])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+
+	targets := e.Targets
+	switch {
+	case *hosts != "":
+		targets = splitTargets(*hosts)
+	case *failedOnly && e.Error == "":
+		// A run that never started failed everywhere: repeat it whole.
+		targets = e.FailedHosts()
+		if len(targets) == 0 {
+			fmt.Printf("[+] Run %d had no failed hosts: nothing to rerun.\n", e.ID)
+			return
+		}
+	}
+	fmt.Printf("[*] Rerunning run %d on %s: %s\n", e.ID, strings.Join(targets, ","), e.Command)
+
+	ctx, stop := interruptContext()
+	defer stop()
+	started := time.Now()
+	opts := e.Options
+	opts.Capture = capture
+	results, err := ssh.ExecuteRemoteMulti(ctx, targets, e.Command, opts)
+	recordRun(targets, e.Command, opts, e.ID, started, results, err)
+	exitForResults(results, err)
+}
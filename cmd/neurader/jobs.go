@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"neurader/internal/audit"
+	"neurader/internal/jobs"
+	"neurader/internal/ssh"
+)
+
+func submitJob(targets []string, command string, opts ssh.RunOptions) {
+	reply, err := jobs.Submit(jobs.SubmitRequest{
+		Targets:  targets,
+		Command:  command,
+		Options:  opts,
+		Operator: audit.Operator(),
+	})
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Printf("[+] Job %s submitted on %d host(s).\n", reply.ID, reply.Hosts)
+	fmt.Printf("[*] Follow it with: neurader job output %s --follow\n", reply.ID)
+}
+
+func cmdJob(argv []string) {
+	usage := func() {
+		fmt.Println("Usage: neurader job <status|output|cancel> <id> [--follow]")
+	}
+	if len(argv) < 1 {
+		usage()
+		return
+	}
+
+	fs := newFlagSet("job " + argv[0])
+	follow := fs.Bool("follow", false, "keep printing output until the job finishes")
+	args, _ := parseArgs(fs, argv[1:])
+	if len(args) < 1 {
+		usage()
+		return
+	}
+	j, err := jobs.Find(args[0])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+
+	switch argv[0] {
+	case "status":
+		jobs.PrintStatus(j)
+	case "output":
+		if err := jobs.PrintOutput(j, *follow); err != nil {
+			fmt.Printf("[!] %v\n", err)
+			os.Exit(2)
+		}
+	case "cancel":
+		if err := jobs.Cancel(j.ID); err != nil {
+			fmt.Printf("[!] %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Printf("[+] Job %s cancelled; remote commands are being terminated.\n", j.ID)
+	default:
+		usage()
+	}
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"fmt"
 	"os"
-	"strings"
 	"path/filepath" // Added for path handling
 
 	"neurader/internal/api"
+	"neurader/internal/control"
+	"neurader/internal/jobs"
+	"neurader/internal/netutil"
+	"neurader/internal/schedule"
 	"neurader/internal/ssh"
 	"neurader/internal/system"
 )
@@ -43,6 +46,14 @@ func main() {
 
 	case "daemon":
 		fmt.Printf("[*] neurader Daemon %s is active...\n", Version)
+		ssh.ServeSessions()
+		jobs.Serve()
+		go schedule.Serve()
+		go func() {
+			if err := control.Serve(control.SocketPath); err != nil {
+				fmt.Printf("[!] Control socket unavailable: %v\n", err)
+			}
+		}()
 		api.StartRegistrationServer("9090")
 
 	case "pending":
@@ -50,7 +61,7 @@ func main() {
 
 	case "accept":
 		if len(os.Args) < 3 {
-			fmt.Println("Error: Provide the IP of the child to accept.")
+			fmt.Println("Error: Provide the node ID or IP of the child to accept.")
 			return
 		}
 		api.AcceptHost(os.Args[2])
@@ -60,10 +71,22 @@ func main() {
 
 	case "add":
         if len(os.Args) < 4 {
-            fmt.Println("Usage: neurader add <Alias> <IP>")
+            fmt.Println("Usage: neurader add <Alias> <IP> [<IP>...]")
             return
         }
-        alias, ip := os.Args[2], os.Args[3]
+        alias := os.Args[2]
+
+        // Extra addresses cover dual-stack hosts (e.g. an IPv4 and an IPv6)
+        var addrs []string
+        for _, a := range os.Args[3:] {
+            n, err := netutil.Normalize(a)
+            if err != nil {
+                fmt.Printf("[!] Invalid address: %v\n", err)
+                return
+            }
+            addrs = append(addrs, n)
+        }
+        ip := addrs[0]
 
         if err := os.MkdirAll(filepath.Dir(api.InventoryPath), 0755); err != nil {
             fmt.Printf("[!] Permission Error: %v\n", err)
@@ -75,7 +98,7 @@ func main() {
             inventory.Hosts = []api.HostEntry{}
         }
         
-        inventory.Hosts = append(inventory.Hosts, api.HostEntry{Name: alias, IP: ip})
+        inventory.Hosts = append(inventory.Hosts, api.HostEntry{Name: alias, IP: ip, Addrs: addrs[1:]})
         api.WriteData(api.InventoryPath, inventory)
         
         fmt.Printf("[+] Manually added %s (%s) to inventory.\n", alias, ip)
@@ -85,12 +108,49 @@ func main() {
         api.ProactiveHandshake()
 		
 	case "run":
-		if len(os.Args) < 4 {
-			fmt.Println("Usage: neurader run <Alias/IP> \"command\"")
-			return
-		}
-		targets := strings.Split(os.Args[2], ",")
-		ssh.ExecuteRemoteMulti(targets, os.Args[3])
+		cmdRun(os.Args[2:])
+
+	case "script":
+		cmdScript(os.Args[2:])
+
+	case "do":
+		cmdDo(os.Args[2:])
+
+	case "apply":
+		cmdApply(os.Args[2:])
+
+	case "template":
+		cmdTemplate(os.Args[2:])
+
+	case "drift":
+		cmdDrift(os.Args[2:])
+
+	case "history":
+		cmdHistory(os.Args[2:])
+
+	case "rerun":
+		cmdRerun(os.Args[2:])
+
+	case "copy":
+		cmdCopy(os.Args[2:])
+
+	case "fetch":
+		cmdFetch(os.Args[2:])
+
+	case "ssh":
+		cmdSSH(os.Args[2:])
+
+	case "tunnel":
+		cmdTunnel(os.Args[2:])
+
+	case "jobs":
+		jobs.PrintList(jobs.List())
+
+	case "job":
+		cmdJob(os.Args[2:])
+
+	case "schedule":
+		cmdSchedule(os.Args[2:])
 
 	default:
 		fmt.Printf("Unknown command: %s\n", os.Args[1])
@@ -100,7 +160,7 @@ func main() {
 
 func showHelp() {
 	fmt.Printf("neurader %s - Automation & Security Tool\n", Version)
-	fmt.Println("Usage: neurader [version | upgrade | install | daemon | pending | accept <IP> | list | add <Alias> <IP> | run <Alias/IP> <cmd>]")
+	fmt.Println("Usage: neurader [version | upgrade | install | daemon | pending | accept <NodeID/IP> | list | add <Alias> <IP> [<IP>...] | run <Alias/IP/@group> <cmd> | history [id] | rerun <id> [--failed-only] | script <file> <targets> -- <args> | do <module> key=value <targets> | apply <playbook.yml> | template <src.tmpl> <targets>:<path> | copy <file> <targets>:<path> | drift [baseline save] <targets> | fetch <targets>:<path> <dir> | ssh <Alias/IP> | tunnel <Alias/IP> L:port:host:port | jobs | job <status|output|cancel> <id> | schedule <list|run-now|pause|resume>]")
 }
 
 func runWizard() {
@@ -138,6 +198,12 @@ func runWizard() {
 	} else if choice == 2 {
 		fmt.Println("[*] Configuring Thin Agent...")
 		system.CreateneuraderUser() 
+		node, err := system.EnsureNodeIdentity()
+		if err != nil {
+			fmt.Printf("[!] Fatal: Could not create node identity: %v\n", err)
+			return
+		}
+		fmt.Printf("[+] Node identity: %s\n", node.ID)
 		system.InstallService()
 
 		fmt.Print("Enter Jumpbox IP: ")
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"neurader/internal/ssh"
+)
+
+// runFlags registers the dispatch flags shared by every multi-host command.
+func runFlags(fs *flag.FlagSet) *ssh.RunOptions {
+	opts := ssh.DefaultRunOptions()
+	fs.IntVar(&opts.Forks, "forks", 0, "maximum hosts to run on concurrently (0 = unlimited)")
+	fs.StringVar(&opts.Serial, "serial", "", "run in sequential batches of N hosts or N% of hosts")
+	fs.DurationVar(&opts.Pause, "pause", 0, "pause between batches (e.g. 30s)")
+	fs.IntVar(&opts.MaxFailPercent, "max-fail-percent", 100, "abort remaining batches when a batch exceeds this failure percentage")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "per-host command timeout (e.g. 5m); 0 = none")
+	fs.StringVar(&opts.Output, "output", "stream", "output mode: stream|grouped|json|summary")
+	fs.StringVar(&opts.Become.User, "become", "", "run as this user via sudo (e.g. postgres)")
+	fs.BoolVar(&opts.Become.Sudo, "sudo", false, "run as root via sudo")
+	fs.IntVar(&opts.Retry.Attempts, "retries", opts.Retry.Attempts, "connection retries per host (commands are never re-run)")
+	fs.DurationVar(&opts.Retry.Backoff, "retry-backoff", opts.Retry.Backoff, "initial delay between connection retries, doubled each time")
+	fs.IntVar(&opts.Breaker.Threshold, "breaker-threshold", opts.Breaker.Threshold, "skip hosts with this many connection failures within --breaker-window (0 = off)")
+	fs.DurationVar(&opts.Breaker.Window, "breaker-window", opts.Breaker.Window, "time window for --breaker-threshold")
+	fs.BoolVar(&opts.Force, "force", false, "run on hosts even if their circuit breaker is open")
+	captureFlags(fs, &opts.Capture)
+	return &opts
+}
+
+// captureFlags registers the --output-dir flags that fill c.
+func captureFlags(fs *flag.FlagSet, c *ssh.Capture) {
+	fs.Var(absPathFlag{&c.Dir}, "output-dir", "also save each host's raw stdout/stderr and a manifest.json of results in this directory")
+	fs.Var(byteSizeFlag{&c.MaxBytes}, "output-max-size", "with --output-dir, keep at most this much of each stream (e.g. 10M; 0 = unlimited)")
+	fs.BoolVar(&c.Compress, "output-compress", false, "with --output-dir, gzip the saved output")
+}
+
+// rejectCapture exits if --output-dir was given to a command that doesn't
+// run through the per-host capture.
+func rejectCapture(opts *ssh.RunOptions, command string) {
+	if opts.Capture.Dir != "" {
+		fmt.Printf("[!] %s doesn't support --output-dir\n", command)
+		os.Exit(2)
+	}
+}
+
+// exitForResults turns a finished run into the process exit code: 2 if the
+// run could not start, 1 if any host failed.
+func exitForResults(results []ssh.Result, err error) {
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	if ssh.AnyFailed(results) {
+		os.Exit(1)
+	}
+}
+
+func cmdRun(argv []string) {
+	fs := newFlagSet("run")
+	opts := runFlags(fs)
+	showRendered := fs.Bool("show-rendered", false, "print the rendered command per host without executing")
+	noTemplate := fs.Bool("no-template", false, "send the command verbatim without template rendering")
+	async := fs.Bool("async", false, "hand the run to the daemon as a background job and print its ID")
+	args, _ := parseArgs(fs, argv)
+	if len(args) < 2 {
+		fmt.Println("Usage: neurader run [flags] <Alias/IP/@group> \"command\"")
+		fs.PrintDefaults()
+		return
+	}
+	opts.Templated = !*noTemplate
+	targets := splitTargets(args[0])
+	if *showRendered {
+		showRenderedCommands(targets, args[1], opts.Templated)
+		return
+	}
+	if *async {
+		submitJob(targets, args[1], *opts)
+		return
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	started := time.Now()
+	results, err := ssh.ExecuteRemoteMulti(ctx, targets, args[1], *opts)
+	recordRun(targets, args[1], *opts, 0, started, results, err)
+	exitForResults(results, err)
+}
+
+func cmdScript(argv []string) {
+	fs := newFlagSet("script")
+	opts := runFlags(fs)
+	args, scriptArgs := parseArgs(fs, argv)
+	if len(args) < 2 {
+		fmt.Println("Usage: neurader script [flags] <file> <Alias/IP/@group> [-- args...]")
+		fs.PrintDefaults()
+		return
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	exitForResults(ssh.ExecuteScript(ctx, splitTargets(args[1]), args[0], scriptArgs, *opts))
+}
+
+func showRenderedCommands(targets []string, command string, templated bool) {
+	cmds, err := ssh.RenderMulti(targets, command, templated)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		return
+	}
+	for _, c := range cmds {
+		if c.Err != nil {
+			fmt.Printf("[%s] %sTemplate error%s: %v\n", c.Host.Name, ssh.ColorRed, ssh.ColorReset, c.Err)
+			continue
+		}
+		fmt.Printf("[%s] %s\n", c.Host.Name, c.Command)
+	}
+}
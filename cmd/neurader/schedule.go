@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"neurader/internal/schedule"
+	"neurader/internal/ssh"
+)
+
+func cmdSchedule(argv []string) {
+	if len(argv) < 1 {
+		fmt.Println("Usage: neurader schedule <list | run-now <name> | pause <name> | resume <name>>")
+		return
+	}
+	sub, args := argv[0], argv[1:]
+	if sub != "list" && len(args) < 1 {
+		fmt.Printf("Usage: neurader schedule %s <name>\n", sub)
+		return
+	}
+
+	var err error
+	switch sub {
+	case "list":
+		err = listSchedules()
+	case "run-now":
+		var id string
+		if id, err = schedule.RunNow(args[0]); err == nil {
+			fmt.Printf("[+] Schedule %s started as job %s.\n", args[0], id)
+		}
+	case "pause", "resume":
+		if err = schedule.SetPaused(args[0], sub == "pause"); err == nil {
+			fmt.Printf("[+] Schedule %s %sd.\n", args[0], sub)
+		}
+	default:
+		fmt.Printf("Unknown schedule command: %s\n", sub)
+		return
+	}
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+}
+
+func listSchedules() error {
+	list, err := schedule.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Printf("No schedules defined in %s.\n", schedule.Path)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCRON\tTARGETS\tSTATE\tNEXT RUN\tLAST RUN\tLAST JOB")
+	fmt.Fprintln(w, "----\t----\t-------\t-----\t--------\t--------\t--------")
+	for _, s := range list {
+		state := ssh.ColorGreen + "active" + ssh.ColorReset
+		next := "-"
+		if !s.Next.IsZero() {
+			next = s.Next.Local().Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.Error != "":
+			state = ssh.ColorRed + "invalid: " + s.Error + ssh.ColorReset
+			next = "-"
+		case s.Running:
+			state = ssh.ColorYellow + "running" + ssh.ColorReset
+		case s.Paused:
+			state = ssh.ColorYellow + "paused" + ssh.ColorReset
+			next = "-"
+		}
+		last, job := "never", "-"
+		if !s.LastRun.IsZero() {
+			last = s.LastRun.Local().Format("2006-01-02 15:04")
+		}
+		if s.LastJob != "" {
+			job = fmt.Sprintf("%s (%s)", s.LastJob, s.LastDone)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Cron, strings.Join(s.Targets, ","), state, next, last, job)
+	}
+	w.Flush()
+	return nil
+}
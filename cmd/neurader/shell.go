@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"neurader/internal/ssh"
+)
+
+func cmdSSH(argv []string) {
+	fs := newFlagSet("ssh")
+	args, command := parseArgs(fs, argv)
+	if len(args) < 1 {
+		fmt.Println("Usage: neurader ssh <Alias/IP> [-- command...]")
+		return
+	}
+	if len(args) > 1 {
+		command = append(args[1:], command...)
+	}
+
+	code, err := ssh.Interactive(args[0], strings.Join(command, " "))
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(255)
+	}
+	fmt.Fprintf(os.Stderr, "[*] Connection to %s closed.\n", args[0])
+	if code < 0 {
+		code = 255
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"neurader/internal/modules"
+	"neurader/internal/ssh"
+)
+
+func cmdTemplate(argv []string) {
+	fs := newFlagSet("template")
+	opts := runFlags(fs)
+	mode := fs.String("mode", "", "octal permissions for the remote file (default: keep the current ones)")
+	owner := fs.String("owner", "", "owner of the remote file")
+	group := fs.String("group", "", "group of the remote file")
+	noBackup := fs.Bool("no-backup", false, "don't keep a timestamped copy of the file being replaced")
+	validate := fs.String("validate", "", "command checking the new file, e.g. \"nginx -t -c %s\": %s is the new file before it replaces the old one; without %s it runs once the file is in place and a failure puts the old one back")
+	reload := fs.String("reload", "", "command run on hosts where the file changed, e.g. \"systemctl reload nginx\"")
+	check := fs.Bool("check", false, "report which hosts would change without changing anything")
+	diff := fs.Bool("diff", false, "show a diff of each host's file")
+	args, _ := parseArgs(fs, argv)
+	if len(args) != 2 {
+		fmt.Println("Usage: neurader template [flags] <src.tmpl> <Alias/IP/@group>:<remote path>")
+		fs.PrintDefaults()
+		return
+	}
+
+	targets, dest, err := ssh.SplitRemoteSpec(args[1])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+	to := modules.TemplateOptions{
+		Mode:     *mode,
+		Owner:    *owner,
+		Group:    *group,
+		Backup:   !*noBackup,
+		Validate: *validate,
+		Reload:   *reload,
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	exitForResults(modules.Template(ctx, targets, args[0], dest, to, modules.Options{Check: *check, Diff: *diff}, *opts))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"neurader/internal/ssh"
+)
+
+func cmdCopy(argv []string) {
+	fs := newFlagSet("copy")
+	opts := runFlags(fs)
+	mode := fs.String("mode", "", "octal permissions for the remote file (default: same as local)")
+	owner := fs.String("owner", "", "chown the remote file to user[:group]")
+	args, _ := parseArgs(fs, argv)
+	if len(args) < 2 {
+		fmt.Println("Usage: neurader copy [flags] <local file> <Alias/IP/@group>:<remote path>")
+		fs.PrintDefaults()
+		return
+	}
+	rejectCapture(opts, "copy")
+
+	copts := ssh.CopyOptions{Owner: *owner, Become: opts.Become}
+	if *mode != "" {
+		m, err := strconv.ParseUint(*mode, 8, 32)
+		if err != nil || m > 07777 {
+			fmt.Printf("[!] Invalid --mode %q: expected octal like 0644\n", *mode)
+			os.Exit(2)
+		}
+		copts.Mode = os.FileMode(m)
+	}
+	targets, remote, err := ssh.SplitRemoteSpec(args[1])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	exitForResults(ssh.CopyToHosts(ctx, targets, args[0], remote, copts, *opts))
+}
+
+func cmdFetch(argv []string) {
+	fs := newFlagSet("fetch")
+	opts := runFlags(fs)
+	args, _ := parseArgs(fs, argv)
+	if len(args) < 2 {
+		fmt.Println("Usage: neurader fetch [flags] <Alias/IP/@group>:<remote path> <local dir>")
+		fs.PrintDefaults()
+		return
+	}
+	rejectCapture(opts, "fetch")
+
+	targets, remote, err := ssh.SplitRemoteSpec(args[0])
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	exitForResults(ssh.FetchFromHosts(ctx, targets, remote, args[1], ssh.FetchOptions{Become: opts.Become}, *opts))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"neurader/internal/ssh"
+)
+
+func cmdTunnel(argv []string) {
+	fs := newFlagSet("tunnel")
+	args, _ := parseArgs(fs, argv)
+	if len(args) < 2 {
+		fmt.Println("Usage: neurader tunnel <Alias/IP> <L:[bind:]port:host:port | R:[bind:]port:host:port | D:[bind:]port>...")
+		return
+	}
+
+	var forwards []ssh.Forward
+	for _, spec := range args[1:] {
+		f, err := ssh.ParseForward(spec)
+		if err != nil {
+			fmt.Printf("[!] %v\n", err)
+			os.Exit(2)
+		}
+		forwards = append(forwards, f)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	if err := ssh.Tunnel(ctx, args[0], forwards); err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[*] Tunnel to %s closed.\n", args[0])
+}
@@ -3,10 +3,13 @@ module neurader
 go 1.21
 
 require (
+	github.com/pkg/sftp v1.13.6
 	golang.org/x/crypto v0.14.0
+	golang.org/x/term v0.13.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
+	github.com/kr/fs v0.1.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 )
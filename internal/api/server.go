@@ -2,14 +2,22 @@ package api
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"neurader/internal/inventory"
+	"neurader/internal/netutil"
+	"neurader/internal/system"
 )
 
 // Standardizing paths for v2
@@ -20,72 +28,288 @@ const (
 	MasterPubKey  = "/etc/neurader/id_rsa.pub"
 )
 
-type HostEntry struct {
-	Name   string `yaml:"name"`
-	IP     string `yaml:"ip"`
-	Synced bool   `yaml:"synced"`
-}
+const (
+	RegistrationPort = 9090 // jumpbox: /register
+	FinalizePort     = 9091 // child: /finalize
+)
 
-type Inventory struct {
-	Hosts []HostEntry `yaml:"hosts"`
-}
+// The inventory model lives in internal/inventory so the SSH executor can
+// share it; these aliases keep the existing api.* call sites working.
+type HostEntry = inventory.HostEntry
+
+type Inventory = inventory.Inventory
 
 /* =========================
    JUMPBOX REGISTRATION
 ========================= */
 
+// registryMu serialises registration handlers touching pending and
+// inventory files.
+var registryMu sync.Mutex
+
+// registrationMaxSkew bounds how old a signed registration may be. Each
+// signature also covers a single-use nonce from /register/nonce, so a
+// captured request cannot be replayed, from another address or otherwise,
+// to redirect a node.
+const registrationMaxSkew = 5 * time.Minute
+
+// maxNonces bounds the nonces handed out and not yet used.
+const maxNonces = 1024
+
+var (
+	nonceMu sync.Mutex
+	nonces  = map[string]time.Time{} // nonce -> issued
+	usedReg = map[string]time.Time{} // "id|ts" of accepted registrations -> when
+)
+
+// issueNonce hands out a nonce valid for registrationMaxSkew.
+func issueNonce() (string, error) {
+	nonceMu.Lock()
+	defer nonceMu.Unlock()
+
+	pruneNonces()
+	if len(nonces) >= maxNonces {
+		return "", fmt.Errorf("too many registrations in progress")
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(buf)
+	nonces[nonce] = time.Now()
+	return nonce, nil
+}
+
+// consumeNonce spends a nonce and the (id, ts) pair it was signed with;
+// either may only be used once.
+func consumeNonce(nonce, id string, ts int64) error {
+	nonceMu.Lock()
+	defer nonceMu.Unlock()
+
+	pruneNonces()
+	if _, ok := nonces[nonce]; !ok {
+		return fmt.Errorf("unknown or already used nonce")
+	}
+	key := id + "|" + strconv.FormatInt(ts, 10)
+	if _, ok := usedReg[key]; ok {
+		return fmt.Errorf("registration already used")
+	}
+	delete(nonces, nonce)
+	usedReg[key] = time.Now()
+	return nil
+}
+
+// pruneNonces drops what has expired. Registrations are remembered for
+// twice the skew, covering timestamps from the future.
+func pruneNonces() {
+	now := time.Now()
+	for n, t := range nonces {
+		if now.Sub(t) > registrationMaxSkew {
+			delete(nonces, n)
+		}
+	}
+	for k, t := range usedReg {
+		if now.Sub(t) > 2*registrationMaxSkew {
+			delete(usedReg, k)
+		}
+	}
+}
+
 func StartRegistrationServer(port string) {
 	// Updated to WriteData
 	WriteData(PendingPath, Inventory{Hosts: []HostEntry{}})
 
+	http.HandleFunc("/register/nonce", func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := issueNonce()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, nonce)
+	})
+
 	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		hostname := r.URL.Query().Get("host")
-		ip := strings.Split(r.RemoteAddr, ":")[0]
+		q := r.URL.Query()
+		hostname := q.Get("host")
+		ip := netutil.RemoteIP(r)
+		entry := HostEntry{ID: q.Get("id"), NodeKey: q.Get("pub"), Name: hostname, IP: ip}
+
+		if entry.ID != "" {
+			if err := verifyRegistration(q); err != nil {
+				fmt.Printf("\n[!] Rejected registration from %s (%s): %v\n> ", hostname, ip, err)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if known, ok := updateKnownNode(entry); ok {
+				fmt.Fprint(w, "known")
+				go refreshKey(known)
+				return
+			}
+		}
 
-		savePending(hostname, ip)
+		savePending(entry)
 
 		fmt.Printf("\n[!] New Registration Request: %s (%s)", hostname, ip)
-		fmt.Printf("\nAction required: sudo neurader accept %s\n> ", ip)
+		fmt.Printf("\nAction required: sudo neurader accept %s\n> ", entry.Key())
 	})
 
 	fmt.Printf("[*] neurader Registration Service (v2) listening on port %s...\n", port)
 	http.ListenAndServe(":"+port, nil)
 }
 
-func savePending(name, ip string) {
+func verifyRegistration(q neturl.Values) error {
+	ts, err := strconv.ParseInt(q.Get("ts"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing timestamp")
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew > registrationMaxSkew || skew < -registrationMaxSkew {
+		return fmt.Errorf("registration timestamp outside allowed window")
+	}
+	nonce := q.Get("nonce")
+	if nonce == "" {
+		return fmt.Errorf("missing nonce")
+	}
+	msg := system.RegistrationMessage(q.Get("id"), q.Get("host"), ts, nonce)
+	if err := system.VerifyNodeSignature(q.Get("id"), q.Get("pub"), q.Get("sig"), msg); err != nil {
+		return err
+	}
+	return consumeNonce(nonce, q.Get("id"), ts)
+}
+
+// updateKnownNode handles a registration from a node that is already in
+// the inventory. If its address changed the record is moved to the new
+// address rather than creating a duplicate pending entry.
+func updateKnownNode(entry HostEntry) (HostEntry, bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	inv := LoadFile(InventoryPath)
+	for i, h := range inv.Hosts {
+		if h.ID != entry.ID {
+			continue
+		}
+		// A host reached through a jump host has an address on the jump
+		// host's network, not the one its registration arrives from.
+		if h.Via == "" && !h.HasAddr(entry.IP) {
+			fmt.Printf("\n[~] Node %s (%s) changed address: %s -> %s\n> ", h.Name, h.ID, h.IP, entry.IP)
+			inv.Hosts[i].IP = entry.IP
+			WriteData(InventoryPath, inv)
+		}
+		return inv.Hosts[i], true
+	}
+	return HostEntry{}, false
+}
+
+// refreshKey re-delivers the master key to a known node that just
+// re-registered. The child only starts its /finalize listener after the
+// registration call returns, so give it a few attempts. Hosts behind a
+// jump host can't be reached over HTTP and are left alone.
+func refreshKey(h HostEntry) {
+	if h.Via != "" {
+		return
+	}
+	pubKey, err := os.ReadFile(MasterPubKey)
+	if err != nil {
+		return
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		time.Sleep(time.Second)
+		resp, err := postFinalize(h, pubKey)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			markSynced(h, true)
+			return
+		}
+	}
+	markFailed(h, fmt.Errorf("key refresh after re-registration failed"))
+}
+
+func savePending(entry HostEntry) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
 	// Updated to LoadFile and WriteData
 	inv := LoadFile(PendingPath)
-	for _, h := range inv.Hosts {
-		if h.IP == ip {
+	for i, h := range inv.Hosts {
+		// Nodes with an identity are matched on it, so several nodes
+		// behind one NAT address each get their own pending entry.
+		if entry.ID != "" && h.ID == entry.ID {
+			inv.Hosts[i] = entry
+			WriteData(PendingPath, inv)
+			return
+		}
+		if entry.ID == "" && h.ID == "" && h.HasAddr(entry.IP) {
 			return
 		}
 	}
-	inv.Hosts = append(inv.Hosts, HostEntry{Name: name, IP: ip})
+	inv.Hosts = append(inv.Hosts, entry)
 	WriteData(PendingPath, inv)
 }
 
-func AcceptHost(childIP string) {
+// findPending matches a pending request by node ID, ID prefix or address.
+func findPending(pending Inventory, target string) ([]int, bool) {
+	var matches []int
+	for i, h := range pending.Hosts {
+		if h.ID != "" && h.ID == target {
+			return []int{i}, true
+		}
+		if (h.ID != "" && len(target) >= 6 && strings.HasPrefix(h.ID, target)) || h.HasAddr(target) {
+			matches = append(matches, i)
+		}
+	}
+	return matches, len(matches) == 1
+}
+
+// findExisting returns the inventory index of the node entry describes,
+// or -1. Nodes with an identity are matched on it, like pending requests,
+// so several nodes behind one NAT address stay apart; otherwise the
+// address decides.
+func findExisting(inv Inventory, entry HostEntry) int {
+	for i, h := range inv.Hosts {
+		if entry.ID != "" && h.ID != "" {
+			if h.ID == entry.ID {
+				return i
+			}
+			continue
+		}
+		if h.Via == "" && h.HasAddr(entry.IP) {
+			return i
+		}
+	}
+	return -1
+}
+
+func AcceptHost(target string) {
 	// Updated to LoadFile and WriteData
 	pending := LoadFile(PendingPath)
 	inventory := LoadFile(InventoryPath)
 
-	var targetEntry HostEntry
-	var newPending []HostEntry
-	found := false
-
-	for _, h := range pending.Hosts {
-		if h.IP == childIP {
-			targetEntry = h
-			found = true
-		} else {
-			newPending = append(newPending, h)
+	matches, ok := findPending(pending, target)
+	if len(matches) == 0 {
+		fmt.Printf("[!] Error: %s is not currently requesting registration.\n", target)
+		return
+	}
+	if !ok {
+		fmt.Printf("[!] Error: %s matches several pending nodes. Accept by node ID instead:\n", target)
+		for _, i := range matches {
+			h := pending.Hosts[i]
+			fmt.Printf(" - %s (%s) id=%s\n", h.Name, h.IP, h.ID)
 		}
+		return
 	}
 
-	if !found {
-		fmt.Printf("[!] Error: IP %s is not currently requesting registration.\n", childIP)
-		return
+	targetEntry := pending.Hosts[matches[0]]
+	var newPending []HostEntry
+	for i, h := range pending.Hosts {
+		if i != matches[0] {
+			newPending = append(newPending, h)
+		}
 	}
+	childIP := targetEntry.IP
 
 	fmt.Printf("[?] Enter custom alias for %s (Default: %s): ", childIP, targetEntry.Name)
 	var alias string
@@ -100,16 +324,29 @@ func AcceptHost(childIP string) {
 		return
 	}
 
-	url := fmt.Sprintf("http://%s:9091/finalize", childIP)
+	url := netutil.HTTPURL(childIP, FinalizePort, "/finalize", nil)
 	resp, err := http.Post(url, "text/plain", bytes.NewBuffer(pubKey))
 	if err != nil || resp.StatusCode != 200 {
 		fmt.Printf("[!] Handshake failed with %s. Is the child agent running?\n", childIP)
 		return
 	}
-
-	inventory.Hosts = append(inventory.Hosts, HostEntry{Name: alias, IP: childIP})
+	resp.Body.Close()
+
+	accepted := targetEntry
+	accepted.Name = alias
+	if i := findExisting(inventory, accepted); i >= 0 {
+		// Same node accepted again: refresh its identity and address but
+		// keep what the operator configured for it.
+		fmt.Printf("[~] %s is already in the inventory as %s; updating that entry.\n", childIP, inventory.Hosts[i].Name)
+		h := &inventory.Hosts[i]
+		h.ID, h.NodeKey, h.Name, h.IP = accepted.ID, accepted.NodeKey, accepted.Name, accepted.IP
+		accepted = *h
+	} else {
+		inventory.Hosts = append(inventory.Hosts, accepted)
+	}
 	WriteData(InventoryPath, inventory)
 	WriteData(PendingPath, Inventory{Hosts: newPending})
+	markSynced(accepted, true)
 
 	fmt.Printf("[+] Success! %s (%s) is now in the active inventory.\n", alias, childIP)
 }
@@ -120,17 +357,45 @@ func AcceptHost(childIP string) {
 
 func SendRequest(jumpboxIP string) {
 	hostname, _ := os.Hostname()
-	url := fmt.Sprintf("http://%s:9090/register?host=%s", jumpboxIP, hostname)
+	node, err := system.EnsureNodeIdentity()
+	if err != nil {
+		fmt.Printf("[!] Could not load node identity: %v\n", err)
+		return
+	}
+
+	nonce, err := fetchNonce(jumpboxIP)
+	if err != nil {
+		fmt.Printf("[!] Could not connect to Jumpbox: %v\n", err)
+		return
+	}
+
+	ts := time.Now().Unix()
+	query := neturl.Values{
+		"host":  {hostname},
+		"id":    {node.ID},
+		"pub":   {node.PublicKeyString()},
+		"ts":    {strconv.FormatInt(ts, 10)},
+		"nonce": {nonce},
+		"sig":   {node.Sign(system.RegistrationMessage(node.ID, hostname, ts, nonce))},
+	}
+	url := netutil.HTTPURL(jumpboxIP, RegistrationPort, "/register", query)
 
-	fmt.Printf("[*] Sending registration request to Jumpbox (%s)...\n", jumpboxIP)
-	_, err := http.Post(url, "text/plain", nil)
+	fmt.Printf("[*] Sending registration request to Jumpbox (%s) as node %s...\n", jumpboxIP, node.ID)
+	resp, err := http.Post(url, "text/plain", nil)
 	if err != nil {
 		fmt.Printf("[!] Could not connect to Jumpbox: %v\n", err)
 		return
 	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("[!] Jumpbox rejected registration: %s\n", strings.TrimSpace(string(body)))
+		return
+	}
+	known := string(body) == "known"
 
 	mux := http.NewServeMux()
-	server := &http.Server{Addr: ":9091", Handler: mux}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", FinalizePort), Handler: mux}
 
 	mux.HandleFunc("/finalize", func(w http.ResponseWriter, r *http.Request) {
 		key, _ := io.ReadAll(r.Body)
@@ -149,10 +414,28 @@ func SendRequest(jumpboxIP string) {
 		go func() { server.Close() }()
 	})
 
-	fmt.Println("[*] Awaiting administrator approval on Jumpbox...")
+	if known {
+		fmt.Println("[*] Jumpbox recognised this node; awaiting key refresh...")
+	} else {
+		fmt.Println("[*] Awaiting administrator approval on Jumpbox...")
+	}
 	server.ListenAndServe()
 }
 
+// fetchNonce asks the jumpbox for a registration nonce to sign.
+func fetchNonce(jumpboxIP string) (string, error) {
+	resp, err := http.Get(netutil.HTTPURL(jumpboxIP, RegistrationPort, "/register/nonce", nil))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("nonce request failed: %s", strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
 /* =========================
    HELPERS (NOW EXPORTED)
 ========================= */
@@ -165,26 +448,22 @@ func ListPending() {
 	}
 	fmt.Println("Current Pending Requests:")
 	for _, h := range inv.Hosts {
-		fmt.Printf(" - %s (%s)\n", h.Name, h.IP)
+		if h.ID != "" {
+			fmt.Printf(" - %s (%s) id=%s\n", h.Name, h.IP, h.ID)
+		} else {
+			fmt.Printf(" - %s (%s)\n", h.Name, h.IP)
+		}
 	}
 }
 
 // Capitalized LoadFile so main.go can see it
 func LoadFile(path string) Inventory {
-	var inv Inventory
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return inv
-	}
-	_ = yaml.Unmarshal(data, &inv)
-	return inv
+	return inventory.Load(path)
 }
 
 // Capitalized WriteData so main.go can see it
 func WriteData(path string, inv Inventory) {
-	data, _ := yaml.Marshal(inv)
-	_ = os.MkdirAll(ConfigDir, 0755)
-	err := os.WriteFile(path, data, 0644)
+	err := inventory.Write(path, inv)
 	if err != nil {
 		fmt.Printf("[!] PERMISSION ERROR: Could not write to %s. Did you use sudo?\n", path)
 	}
@@ -196,6 +475,10 @@ func ProactiveHandshake() {
 		fmt.Println("[!] Inventory is empty. Please add nodes to /etc/neurader/hosts.yml first.")
 		return
 	}
+	if err := inventory.Validate(); err != nil {
+		fmt.Printf("[!] Invalid inventory: %v\n", err)
+		return
+	}
 
 	pubKey, err := os.ReadFile(MasterPubKey)
 	if err != nil {
@@ -206,20 +489,60 @@ func ProactiveHandshake() {
 	fmt.Printf("[*] Attempting handshake with %d nodes...\n", len(inventory.Hosts))
 
 	for _, host := range inventory.Hosts {
-		url := fmt.Sprintf("http://%s:9091/finalize", host.IP)
+		if host.Via != "" {
+			// The handshake port isn't reachable through the jump host's
+			// SSH route, so the master key has to be installed by hand.
+			fmt.Printf(" -> Skipping %s (%s via %s): handshake is not routed through jump hosts\n", host.Name, host.IP, host.Via)
+			continue
+		}
 		fmt.Printf(" -> Connecting to %s (%s)... ", host.Name, host.IP)
 
-		resp, err := http.Post(url, "text/plain", bytes.NewBuffer(pubKey))
+		resp, err := postFinalize(host, pubKey)
 		if err != nil {
 			fmt.Printf("FAILED: %v\n", err)
+			markFailed(host, err)
 			continue
 		}
 
 		if resp.StatusCode == http.StatusOK {
 			fmt.Println("SUCCESS ✅")
+			markSynced(host, true)
 		} else {
 			fmt.Printf("FAILED (Status: %d)\n", resp.StatusCode)
+			markFailed(host, fmt.Errorf("handshake returned status %d", resp.StatusCode))
 		}
 		resp.Body.Close()
 	}
 }
+
+// postFinalize delivers the master key to the first address of host that
+// answers, so dual-stack children are reached over either family.
+func postFinalize(host HostEntry, pubKey []byte) (*http.Response, error) {
+	var lastErr error
+	for _, addr := range host.Addresses() {
+		url := netutil.HTTPURL(addr, FinalizePort, "/finalize", nil)
+		resp, err := http.Post(url, "text/plain", bytes.NewBuffer(pubKey))
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// markSynced records the outcome of a key handshake in state.yml.
+func markSynced(h HostEntry, synced bool) {
+	_ = inventory.UpdateState(h, func(s *inventory.HostState) {
+		s.Synced = synced
+		if synced {
+			s.Seen(time.Now())
+		}
+	})
+}
+
+// markFailed records a failed handshake attempt in state.yml. The
+// handshake port is closed once a node is enrolled, so this is not an SSH
+// failure and must not trip the circuit breaker.
+func markFailed(h HostEntry, err error) {
+	inventory.NoteError(h, err)
+}
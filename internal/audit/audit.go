@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+/* ========================================================================
+   AUDIT LOG
+   Operator actions that give direct access to a host (interactive shells,
+   tunnels, and anything else that bypasses the normal run pipeline) are
+   appended to audit.log as one JSON object per line.
+   ======================================================================== */
+
+const (
+	Dir         = "/var/log/neurader"
+	LogPath     = Dir + "/audit.log"
+	SessionsDir = Dir + "/sessions"
+)
+
+type Event struct {
+	Time      time.Time `json:"time"`
+	Operator  string    `json:"operator"`
+	Action    string    `json:"action"`
+	Host      string    `json:"host,omitempty"`
+	Addr      string    `json:"addr,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	Recording string    `json:"recording,omitempty"`
+	Forwards  []string  `json:"forwards,omitempty"`
+	Conns     int       `json:"connections,omitempty"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Record appends ev to the audit log, filling in the time and operator.
+func Record(ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Operator == "" {
+		ev.Operator = Operator()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(LogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Operator names the person behind the command: the invoking user when
+// run through sudo, otherwise the current user.
+func Operator() string {
+	if u := os.Getenv("SUDO_USER"); u != "" {
+		return u
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return fmt.Sprintf("uid:%d", os.Getuid())
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Recording captures a terminal session's output in asciicast v2 format,
+// so it can be replayed with "asciinema play". Keystrokes are not
+// recorded: they would capture passwords typed at remote prompts.
+type Recording struct {
+	Path string
+
+	mu      sync.Mutex
+	f       *os.File
+	start   time.Time
+	pending []byte // incomplete UTF-8 sequence carried to the next write
+}
+
+// NewRecording creates a recording file for a session on host.
+func NewRecording(host string, width, height int, title string) (*Recording, error) {
+	if err := os.MkdirAll(SessionsDir, 0700); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	name := fmt.Sprintf("%s-%s-%d.cast", start.Format("20060102-150405"), fileSafe(host), os.Getpid())
+	path := filepath.Join(SessionsDir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]interface{}{
+		"version":   2,
+		"width":     width,
+		"height":    height,
+		"timestamp": start.Unix(),
+		"title":     title,
+		"env":       map[string]string{"TERM": os.Getenv("TERM")},
+	}
+	data, _ := json.Marshal(header)
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Recording{Path: path, f: f, start: start}, nil
+}
+
+// Write records terminal output. It always reports success so a full disk
+// never interrupts the live session.
+func (r *Recording) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.event("o", string(data[:cut]))
+	}
+	return len(p), nil
+}
+
+// Resize records a terminal size change.
+func (r *Recording) Resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+func (r *Recording) event(kind, data string) {
+	line, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), kind, data})
+	r.f.Write(append(line, '\n'))
+}
+
+func (r *Recording) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	return r.f.Close()
+}
+
+func fileSafe(s string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+			return c
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,263 @@
+package control
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/* ========================================================================
+   DAEMON CONTROL SOCKET
+   Short-lived CLI invocations talk to the running daemon over a Unix
+   socket. Every message is a frame: one type byte, a big-endian uint32
+   length and the payload. A connection opens with a request frame naming
+   the operation; what follows is up to that operation's handler.
+   ======================================================================== */
+
+const SocketPath = "/run/neurader/control.sock"
+
+// FrameRequest opens every connection; its payload is a JSON Request.
+const FrameRequest byte = 'q'
+
+// maxFrame guards against a corrupt length prefix allocating gigabytes.
+const maxFrame = 16 << 20
+
+type Request struct {
+	Op   string          `json:"op"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Conn is a framed control connection. Writes are serialised so several
+// goroutines (stdout/stderr pumps) can share one connection.
+type Conn struct {
+	net.Conn
+	r   *bufio.Reader
+	wmu sync.Mutex
+}
+
+func newConn(c net.Conn) *Conn {
+	return &Conn{Conn: c, r: bufio.NewReader(c)}
+}
+
+// WriteFrame sends one frame.
+func (c *Conn) WriteFrame(typ byte, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	var hdr [5]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err := c.Conn.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(data)
+	return err
+}
+
+// WriteJSON sends v as a JSON frame.
+func (c *Conn) WriteJSON(typ byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteFrame(typ, data)
+}
+
+// ReadFrame reads the next frame.
+func (c *Conn) ReadFrame() (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxFrame {
+		return 0, nil, fmt.Errorf("control frame too large (%d bytes)", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], data, nil
+}
+
+// writeChunk is the most a FrameWriter puts in one frame. io.Copy hands a
+// bytes.Reader's whole content to a single Write, which could exceed
+// maxFrame; small frames also let stdout and stderr interleave.
+const writeChunk = 32 << 10
+
+// FrameWriter adapts a frame type to io.Writer, e.g. for session output.
+type FrameWriter struct {
+	Conn *Conn
+	Type byte
+}
+
+func (w FrameWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > writeChunk {
+			chunk = chunk[:writeChunk]
+		}
+		if err := w.Conn.WriteFrame(w.Type, chunk); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+/* =========================
+   SERVER
+========================= */
+
+// Handler serves one operation. It owns conn until it returns.
+type Handler func(conn *Conn, body json.RawMessage)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+)
+
+// Handle registers the handler for an operation.
+func Handle(op string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[op] = h
+}
+
+// Serve listens on path and dispatches connections until the listener
+// fails. The socket is root-only: it hands out the master key's reach.
+func Serve(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return err
+	}
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(newConn(c))
+	}
+}
+
+func serveConn(conn *Conn) {
+	defer conn.Close()
+	typ, data, err := conn.ReadFrame()
+	if err != nil || typ != FrameRequest {
+		return
+	}
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return
+	}
+
+	handlersMu.RLock()
+	h, ok := handlers[req.Op]
+	handlersMu.RUnlock()
+	if !ok {
+		_ = conn.WriteJSON(FrameError, ErrorBody{Error: fmt.Sprintf("unknown operation %q", req.Op)})
+		return
+	}
+	h(conn, req.Body)
+}
+
+// FrameError carries an ErrorBody when the daemon cannot serve a request.
+const FrameError byte = '!'
+
+// FrameReply carries the JSON response of a request/response operation.
+const FrameReply byte = '='
+
+type ErrorBody struct {
+	Error string `json:"error"`
+}
+
+// Reply answers a request/response operation: err is sent as a
+// FrameError, otherwise resp as a FrameReply.
+func Reply(conn *Conn, resp interface{}, err error) {
+	if err != nil {
+		_ = conn.WriteJSON(FrameError, ErrorBody{Error: err.Error()})
+		return
+	}
+	_ = conn.WriteJSON(FrameReply, resp)
+}
+
+/* =========================
+   CLIENT
+========================= */
+
+// Dial connects to the daemon and sends the request for op. It fails fast
+// when no daemon is running so callers can fall back to working locally.
+func Dial(op string, body interface{}) (*Conn, error) {
+	c, err := net.Dial("unix", SocketPath)
+	if err != nil {
+		return nil, err
+	}
+	conn := newConn(c)
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.WriteJSON(FrameRequest, Request{Op: op, Body: raw}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Running reports whether a daemon is listening on the control socket.
+func Running() bool {
+	c, err := net.Dial("unix", SocketPath)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// ErrNoDaemon is returned by Call when no daemon is listening.
+var ErrNoDaemon = errors.New("the neurader daemon is not running (start it with: neurader daemon)")
+
+// Call performs a request/response operation, decoding the daemon's
+// reply into resp (which may be nil).
+func Call(op string, body, resp interface{}) error {
+	conn, err := Dial(op, body)
+	if err != nil {
+		return ErrNoDaemon
+	}
+	defer conn.Close()
+
+	typ, data, err := conn.ReadFrame()
+	if err != nil {
+		return fmt.Errorf("daemon closed the connection: %v", err)
+	}
+	switch typ {
+	case FrameError:
+		var e ErrorBody
+		_ = json.Unmarshal(data, &e)
+		return errors.New(e.Error)
+	case FrameReply:
+		if resp == nil {
+			return nil
+		}
+		return json.Unmarshal(data, resp)
+	}
+	return fmt.Errorf("unexpected reply frame %q", typ)
+}
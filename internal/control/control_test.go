@@ -0,0 +1,44 @@
+package control
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestFrameWriterLargeInput(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	w, r := newConn(a), newConn(b)
+
+	data := make([]byte, maxFrame+writeChunk+1)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		// A bytes.Reader goes through WriteTo: one Write with everything.
+		_, err := io.Copy(FrameWriter{Conn: w, Type: 'i'}, bytes.NewReader(data))
+		errc <- err
+	}()
+
+	var got []byte
+	for len(got) < len(data) {
+		typ, frame, err := r.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame after %d bytes: %v", len(got), err)
+		}
+		if typ != 'i' || len(frame) > writeChunk {
+			t.Fatalf("frame type %q, %d bytes", typ, len(frame))
+		}
+		got = append(got, frame...)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("io.Copy: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("data changed in transit")
+	}
+}
@@ -0,0 +1,224 @@
+package drift
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   COMPARISON
+========================= */
+
+// Outlier is an item on which hosts disagree. When most hosts share a
+// value, Hosts holds only the ones that don't; otherwise there is no
+// majority (Split) and Hosts holds every host.
+type Outlier struct {
+	Item     string
+	Majority string // "" when absent on most hosts
+	Count    int    // hosts with the majority value
+	Split    bool
+	Hosts    map[string]string // host -> its value, "" if absent
+}
+
+// Change is an item whose value differs from the baseline.
+type Change struct {
+	Host   string
+	Item   string
+	Before string // "" if absent from the baseline
+	After  string // "" if absent now
+}
+
+// Outliers compares the hosts of snap with each other.
+func Outliers(snap *Snapshot) []Outlier {
+	hosts := snap.hostNames()
+	var outliers []Outlier
+	for _, item := range snap.itemKeys() {
+		counts := map[string]int{}
+		for _, h := range hosts {
+			counts[snap.Hosts[h][item]]++
+		}
+		if len(counts) == 1 {
+			continue
+		}
+		o := Outlier{Item: item, Hosts: map[string]string{}}
+		for v, n := range counts {
+			if n > o.Count || (n == o.Count && v < o.Majority) {
+				o.Majority, o.Count = v, n
+			}
+		}
+		o.Split = o.Count*2 <= len(hosts)
+		for _, h := range hosts {
+			if v := snap.Hosts[h][item]; o.Split || v != o.Majority {
+				o.Hosts[h] = v
+			}
+		}
+		outliers = append(outliers, o)
+	}
+	return outliers
+}
+
+// Changes compares cur with the baseline, host by host, on the items both
+// collected. It also returns the hosts that are new since the baseline,
+// and the baseline hosts that are missing now: they failed to collect, or
+// left the group the baseline was taken of.
+func Changes(base, cur *Snapshot) (changes []Change, added, missing []string) {
+	for _, h := range cur.hostNames() {
+		before, ok := base.Hosts[h]
+		if !ok {
+			added = append(added, h)
+			continue
+		}
+		after := cur.Hosts[h]
+		keys := map[string]bool{}
+		for k := range before {
+			keys[k] = true
+		}
+		for k := range after {
+			keys[k] = true
+		}
+		for _, k := range sortedKeys(keys) {
+			if !collectedByBoth(k, base.Spec, cur.Spec) || before[k] == after[k] {
+				continue
+			}
+			changes = append(changes, Change{Host: h, Item: k, Before: before[k], After: after[k]})
+		}
+	}
+	sameTargets := strings.Join(base.Targets, ",") == strings.Join(cur.Targets, ",")
+	for _, h := range base.hostNames() {
+		if _, ok := cur.Hosts[h]; !ok && (sameTargets || contains(cur.targeted, h)) {
+			missing = append(missing, h)
+		}
+	}
+	return changes, added, missing
+}
+
+func collectedByBoth(key string, a, b Spec) bool {
+	kind, name, _ := strings.Cut(key, ":")
+	switch kind {
+	case KindPackage:
+		return a.Packages && b.Packages
+	case KindService:
+		return a.Services && b.Services
+	case KindFile:
+		return contains(a.Files, name) && contains(b.Files, name)
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Snapshot) hostNames() []string {
+	names := make([]string, 0, len(s.Hosts))
+	for h := range s.Hosts {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Snapshot) itemKeys() []string {
+	keys := map[string]bool{}
+	for _, items := range s.Hosts {
+		for k := range items {
+			keys[k] = true
+		}
+	}
+	return sortedKeys(keys)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/* =========================
+   REPORT
+========================= */
+
+// display shortens checksums and marks absent items.
+func display(item, v string) string {
+	switch {
+	case v == "":
+		return "-"
+	case strings.HasPrefix(item, KindFile+":") && len(v) == 64:
+		return v[:12]
+	}
+	return v
+}
+
+// PrintOutliers lists the items hosts disagree on and reports whether
+// there were any.
+func PrintOutliers(snap *Snapshot, outliers []Outlier) bool {
+	if len(snap.Hosts) < 2 {
+		fmt.Println("[~] Only one host collected: nothing to compare it with.")
+		return false
+	}
+	if len(outliers) == 0 {
+		fmt.Printf("%s[+] All %d host(s) agree.%s\n", ssh.ColorGreen, len(snap.Hosts), ssh.ColorReset)
+		return false
+	}
+
+	fmt.Printf("\n%s[!] %d item(s) differ between hosts:%s\n", ssh.ColorYellow, len(outliers), ssh.ColorReset)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tHOST\tVALUE\tMOST HOSTS")
+	fmt.Fprintln(w, "----\t----\t-----\t----------")
+	for _, o := range outliers {
+		most := fmt.Sprintf("%s (%d/%d)", display(o.Item, o.Majority), o.Count, len(snap.Hosts))
+		if o.Split {
+			most = "no majority"
+		}
+		for _, h := range snap.hostNames() {
+			v, ok := o.Hosts[h]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", o.Item, h, display(o.Item, v), most)
+		}
+	}
+	w.Flush()
+	return true
+}
+
+// PrintChanges lists what changed since the baseline and reports whether
+// anything did.
+func PrintChanges(base *Snapshot, changes []Change, added, missing []string) bool {
+	when := base.Taken.Local().Format("2006-01-02 15:04")
+	if len(changes) == 0 && len(added) == 0 && len(missing) == 0 {
+		fmt.Printf("%s[+] No changes since baseline %q (saved %s).%s\n", ssh.ColorGreen, base.Name, when, ssh.ColorReset)
+		return false
+	}
+
+	fmt.Printf("\n%s[!] Changes since baseline %q (saved %s):%s\n", ssh.ColorYellow, base.Name, when, ssh.ColorReset)
+	if len(changes) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "HOST\tITEM\tBASELINE\tNOW")
+		fmt.Fprintln(w, "----\t----\t--------\t---")
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Host, c.Item, display(c.Item, c.Before), display(c.Item, c.After))
+		}
+		w.Flush()
+	}
+	if len(added) > 0 {
+		fmt.Printf("[~] Not in the baseline: %s\n", strings.Join(added, ", "))
+	}
+	if len(missing) > 0 {
+		fmt.Printf("[~] In the baseline but not collected now: %s\n", strings.Join(missing, ", "))
+	}
+	return true
+}
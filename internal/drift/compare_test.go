@@ -0,0 +1,132 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutliers(t *testing.T) {
+	snap := &Snapshot{Hosts: map[string]Items{
+		"a": {"package:nginx": "1.24", "service:nginx.service": "enabled", "file:/etc/motd": "x"},
+		"b": {"package:nginx": "1.24", "service:nginx.service": "enabled", "file:/etc/motd": "y"},
+		"c": {"package:nginx": "1.22", "service:nginx.service": "enabled", "file:/etc/motd": "z"},
+		"d": {"package:nginx": "1.24", "file:/etc/motd": "w"},
+	}}
+	got := Outliers(snap)
+	want := []Outlier{
+		// No value is shared by more than half the hosts.
+		{Item: "file:/etc/motd", Majority: "w", Count: 1, Split: true,
+			Hosts: map[string]string{"a": "x", "b": "y", "c": "z", "d": "w"}},
+		{Item: "package:nginx", Majority: "1.24", Count: 3,
+			Hosts: map[string]string{"c": "1.22"}},
+		// Absent on one host.
+		{Item: "service:nginx.service", Majority: "enabled", Count: 3,
+			Hosts: map[string]string{"d": ""}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Outliers =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestOutliersTie(t *testing.T) {
+	snap := &Snapshot{Hosts: map[string]Items{
+		"a": {"package:curl": "8.1"},
+		"b": {"package:curl": "8.2"},
+	}}
+	got := Outliers(snap)
+	if len(got) != 1 || !got[0].Split || len(got[0].Hosts) != 2 {
+		t.Errorf("a 1/1 split should report both hosts with no majority, got %+v", got)
+	}
+}
+
+func TestOutliersAgree(t *testing.T) {
+	snap := &Snapshot{Hosts: map[string]Items{
+		"a": {"package:curl": "8.1"},
+		"b": {"package:curl": "8.1"},
+	}}
+	if got := Outliers(snap); len(got) != 0 {
+		t.Errorf("Outliers = %+v, want none", got)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	base := &Snapshot{
+		Targets: []string{"@web"},
+		Spec:    Spec{Files: []string{"/etc/motd", "/etc/hosts"}, Packages: true},
+		Hosts: map[string]Items{
+			"a": {"package:nginx": "1.22", "package:curl": "8.1", "file:/etc/motd": "x", "file:/etc/hosts": "h"},
+			"b": {"package:nginx": "1.22"},
+			"c": {"package:nginx": "1.22"},
+		},
+	}
+	cur := &Snapshot{
+		Targets: []string{"@web"},
+		// Services weren't in the baseline and /etc/hosts is no longer
+		// collected: neither can be compared.
+		Spec: Spec{Files: []string{"/etc/motd"}, Packages: true, Services: true},
+		Hosts: map[string]Items{
+			"a": {"package:nginx": "1.24", "file:/etc/motd": "y", "service:nginx.service": "enabled"},
+			"b": {"package:nginx": "1.22"},
+			"d": {"package:nginx": "1.24"},
+		},
+		targeted: []string{"a", "b", "c", "d"},
+	}
+	changes, added, missing := Changes(base, cur)
+	wantChanges := []Change{
+		{Host: "a", Item: "file:/etc/motd", Before: "x", After: "y"},
+		{Host: "a", Item: "package:curl", Before: "8.1", After: ""},
+		{Host: "a", Item: "package:nginx", Before: "1.22", After: "1.24"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes =\n%+v\nwant\n%+v", changes, wantChanges)
+	}
+	if !reflect.DeepEqual(added, []string{"d"}) {
+		t.Errorf("added = %q, want [d]", added)
+	}
+	if !reflect.DeepEqual(missing, []string{"c"}) {
+		t.Errorf("missing = %q, want [c]", missing)
+	}
+}
+
+func TestChangesOtherTargets(t *testing.T) {
+	base := &Snapshot{
+		Targets: []string{"@web"},
+		Spec:    Spec{Packages: true},
+		Hosts:   map[string]Items{"a": {}, "b": {}},
+	}
+	// Only "a" was targeted this time, so "b" isn't missing.
+	cur := &Snapshot{
+		Targets:  []string{"a"},
+		Spec:     Spec{Packages: true},
+		Hosts:    map[string]Items{},
+		targeted: []string{"a"},
+	}
+	_, _, missing := Changes(base, cur)
+	if !reflect.DeepEqual(missing, []string{"a"}) {
+		t.Errorf("missing = %q, want [a]", missing)
+	}
+}
+
+func TestDefaultName(t *testing.T) {
+	tests := []struct {
+		targets []string
+		want    string
+	}{
+		{[]string{"@web"}, "web"},
+		{[]string{"@web", "@db"}, "db_web"},
+		{[]string{"web1"}, "web1"},
+		{[]string{"::1"}, "1"},
+		{[]string{"10.0.0.1"}, "10.0.0.1"},
+		{[]string{"fe80::1%eth0"}, "fe80_1_eth0"},
+	}
+	for _, tt := range tests {
+		if got := DefaultName(tt.targets); got != tt.want {
+			t.Errorf("DefaultName(%q) = %q, want %q", tt.targets, got, tt.want)
+		}
+	}
+	for name, want := range map[string]bool{"web": true, "db_web-1.0": true, "": false, ".": false, "..": false, "a/b": false} {
+		if got := ValidName(name); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package drift
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"neurader/internal/ssh"
+)
+
+/* ========================================================================
+   CONFIGURATION DRIFT
+   "drift" collects a fingerprint of each host: checksums of chosen files,
+   installed package versions and enabled services. Hosts are compared
+   with each other, to find the ones that differ from the rest of their
+   group, and with a baseline snapshot saved earlier by
+   "drift baseline save", to find what changed since. Baselines are JSON
+   files under Dir, one per name.
+   ======================================================================== */
+
+const Dir = "/var/lib/neurader/drift"
+
+// Item kinds, used as key prefixes: "file:/etc/hosts", "package:nginx",
+// "service:nginx.service".
+const (
+	KindFile    = "file"
+	KindPackage = "package"
+	KindService = "service"
+)
+
+// Spec selects what to collect.
+type Spec struct {
+	Files    []string `json:"files,omitempty"`
+	Packages bool     `json:"packages"`
+	Services bool     `json:"services"`
+}
+
+// Items is one host's fingerprint: item key -> value. Files map to their
+// SHA-256, or "missing"/"unreadable"; packages to their version; enabled
+// services to "enabled". Packages that aren't installed and services that
+// aren't enabled are simply absent.
+type Items map[string]string
+
+// Snapshot is a fingerprint of every host in a run.
+type Snapshot struct {
+	Name    string           `json:"name"`
+	Targets []string         `json:"targets"`
+	Spec    Spec             `json:"spec"`
+	Taken   time.Time        `json:"taken"`
+	Hosts   map[string]Items `json:"hosts"`
+
+	targeted []string // every host the targets matched, collected or not
+}
+
+/* =========================
+   COLLECTION
+========================= */
+
+// script prints one line per item: "F <sum> <path>", "P <name> <version>"
+// or "S <unit>".
+func script(spec Spec) string {
+	var b strings.Builder
+	for _, f := range spec.Files {
+		fmt.Fprintf(&b, "f=%s\n", ssh.ShellQuote(f))
+		b.WriteString(`if [ ! -e "$f" ]; then echo "F missing $f"
+elif sum=$(sha256sum < "$f" 2>/dev/null); then echo "F ${sum%% *} $f"
+else echo "F unreadable $f"
+fi
+`)
+	}
+	if spec.Packages {
+		b.WriteString(`if command -v dpkg-query >/dev/null 2>&1; then
+	dpkg-query -W -f='${db:Status-Abbrev} ${Package} ${Version}\n' | awk '$1 == "ii" { print "P " $2 " " $3 }'
+elif command -v rpm >/dev/null 2>&1; then
+	rpm -qa --qf 'P %{NAME} %{VERSION}-%{RELEASE}\n'
+elif command -v apk >/dev/null 2>&1; then
+	apk info -v 2>/dev/null | sed -n 's/^\(.*\)-\([^-]*-r[0-9]*\)$/P \1 \2/p'
+else
+	echo "no supported package manager (dpkg, rpm or apk)" >&2
+	exit 1
+fi
+`)
+	}
+	if spec.Services {
+		b.WriteString(`if command -v systemctl >/dev/null 2>&1; then
+	systemctl list-unit-files --type=service --state=enabled --no-legend --no-pager | awk 'NF { print "S " $1 }'
+else
+	echo "systemctl not found (service collection needs systemd)" >&2
+	exit 1
+fi
+`)
+	}
+	return b.String()
+}
+
+// parse reads the script's output into Items.
+func parse(stdout []byte) Items {
+	items := Items{}
+	sc := bufio.NewScanner(bytes.NewReader(stdout))
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), " ", 3)
+		switch {
+		case fields[0] == "F" && len(fields) == 3:
+			items[KindFile+":"+fields[2]] = fields[1]
+		case fields[0] == "P" && len(fields) == 3:
+			items[KindPackage+":"+fields[1]] = fields[2]
+		case fields[0] == "S" && len(fields) == 2:
+			items[KindService+":"+fields[1]] = "enabled"
+		}
+	}
+	return items
+}
+
+// Collect fingerprints every target. Hosts that could not be collected
+// are left out of the snapshot and returned as failed results.
+func Collect(ctx context.Context, targets []string, spec Spec, opts ssh.RunOptions) (*Snapshot, []ssh.Result, error) {
+	if len(spec.Files) == 0 && !spec.Packages && !spec.Services {
+		return nil, nil, fmt.Errorf("nothing to collect: give --files, or leave packages or services on")
+	}
+	for _, f := range spec.Files {
+		if !strings.HasPrefix(f, "/") {
+			return nil, nil, fmt.Errorf("file paths must be absolute: %q", f)
+		}
+	}
+
+	cmds, err := ssh.RenderMulti(targets, script(spec), false)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("[*] Collecting from %d host(s)...\n", len(cmds))
+	results, err := ssh.ExecuteCommands(ctx, collectOutput{}, cmds, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snap := &Snapshot{Targets: targets, Spec: spec, Taken: time.Now(), Hosts: map[string]Items{}}
+	var failed []ssh.Result
+	for _, r := range results {
+		snap.targeted = append(snap.targeted, r.Host.Name)
+		if !r.OK() {
+			failed = append(failed, r)
+			continue
+		}
+		snap.Hosts[r.Host.Name] = parse(r.Stdout)
+	}
+	return snap, failed, nil
+}
+
+// collectOutput keeps collection quiet apart from hosts that fail.
+type collectOutput struct{}
+
+func (collectOutput) Info(format string, args ...interface{})      {}
+func (collectOutput) Start(host ssh.HostEntry)                     {}
+func (collectOutput) Line(host ssh.HostEntry, stream, line string) {}
+func (collectOutput) Close(results []ssh.Result)                   {}
+
+func (collectOutput) Finish(r ssh.Result) {
+	if r.OK() {
+		return
+	}
+	why := r.Status()
+	if r.Err != nil {
+		why = r.Err.Error()
+	} else if msg := strings.TrimSpace(string(r.Stderr)); msg != "" {
+		why = msg
+	}
+	fmt.Printf("[%s] %sCollection failed%s: %s\n", r.Host.Name, ssh.ColorRed, ssh.ColorReset, why)
+}
+
+/* =========================
+   BASELINES
+========================= */
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// DefaultName derives a baseline name from the targets: "@web" -> "web".
+func DefaultName(targets []string) string {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = strings.TrimPrefix(t, "@")
+	}
+	sort.Strings(names)
+	return strings.Trim(unsafeName.ReplaceAllString(strings.Join(names, "_"), "_"), "_.")
+}
+
+func baselinePath(name string) string {
+	return filepath.Join(Dir, name+".json")
+}
+
+// ValidName reports whether name can be used as a baseline file name.
+func ValidName(name string) bool {
+	return name != "" && !unsafeName.MatchString(name) && strings.Trim(name, ".") != ""
+}
+
+// SaveBaseline stores snap under its name, replacing any earlier one.
+func SaveBaseline(snap *Snapshot) (string, error) {
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := baselinePath(snap.Name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// LoadBaseline reads a saved baseline; it returns nil if there is none.
+func LoadBaseline(name string) (*Snapshot, error) {
+	data, err := os.ReadFile(baselinePath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("baseline %s: %v", name, err)
+	}
+	return &snap, nil
+}
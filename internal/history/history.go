@@ -0,0 +1,198 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"neurader/internal/audit"
+	"neurader/internal/ssh"
+)
+
+/* ========================================================================
+   RUN HISTORY
+   Every "run", in the foreground or as a background job, is recorded
+   under Dir as <id>.json with its command,
+   targets, options and per-host results, so "history" can list past runs
+   and "rerun" can repeat one, on every host or only on those that failed.
+   IDs are sequential; the oldest records are pruned beyond Keep.
+   ======================================================================== */
+
+const (
+	Dir  = "/var/lib/neurader/history"
+	Keep = 1000
+)
+
+type Entry struct {
+	ID       int            `json:"id"`
+	Command  string         `json:"command"`
+	Targets  []string       `json:"targets"`
+	Options  ssh.RunOptions `json:"options"`
+	Operator string         `json:"operator"`
+	RerunOf  int            `json:"rerun_of,omitempty"`
+	Job      string         `json:"job,omitempty"` // the background job that ran it
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Error    string         `json:"error,omitempty"` // the run could not start
+	Results  []HostResult   `json:"results"`
+}
+
+// HostResult is the persisted form of an ssh.Result, shared with jobs.
+type HostResult struct {
+	Host       string `json:"host"`
+	Address    string `json:"address"`
+	Status     string `json:"status"`
+	OK         bool   `json:"ok"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewHostResult converts a finished result for storage.
+func NewHostResult(r ssh.Result) HostResult {
+	hr := HostResult{
+		Host:       r.Host.Name,
+		Address:    r.Host.IP,
+		Status:     r.Status(),
+		OK:         r.OK(),
+		DurationMS: r.Duration.Milliseconds(),
+	}
+	if r.ExitCode >= 0 {
+		code := r.ExitCode
+		hr.ExitCode = &code
+	}
+	if r.Err != nil {
+		hr.Error = r.Err.Error()
+	}
+	return hr
+}
+
+// Counts tallies the hosts.
+func (e Entry) Counts() (ok, failed int) {
+	for _, r := range e.Results {
+		if r.OK {
+			ok++
+		} else {
+			failed++
+		}
+	}
+	return ok, failed
+}
+
+// FailedHosts lists the hosts that didn't succeed, including those
+// cancelled or skipped when the run was interrupted.
+func (e Entry) FailedHosts() []string {
+	var hosts []string
+	for _, r := range e.Results {
+		if !r.OK {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	return hosts
+}
+
+func entryPath(id int) string {
+	return filepath.Join(Dir, strconv.Itoa(id)+".json")
+}
+
+// Record stores a finished run described by e, with its results, and
+// returns its ID. The operator defaults to whoever is running neurader.
+func Record(e Entry, results []ssh.Result, runErr error) (int, error) {
+	if e.Operator == "" {
+		e.Operator = audit.Operator()
+	}
+	e.Finished = time.Now()
+	if runErr != nil {
+		e.Error = runErr.Error()
+	}
+	for _, r := range results {
+		e.Results = append(e.Results, NewHostResult(r))
+	}
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return 0, err
+	}
+
+	// Claim the next free ID; O_EXCL keeps concurrent runs apart.
+	ids := listIDs()
+	next := 1
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	for ; ; next++ {
+		f, err := os.OpenFile(entryPath(next), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		e.ID = next
+		data, err := json.MarshalIndent(e, "", "  ")
+		if err == nil {
+			_, err = f.Write(data)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return 0, err
+		}
+		break
+	}
+
+	if len(ids) >= Keep {
+		for _, id := range ids[:len(ids)-Keep+1] {
+			os.Remove(entryPath(id))
+		}
+	}
+	return e.ID, nil
+}
+
+// listIDs returns the recorded IDs in ascending order.
+func listIDs() []int {
+	entries, _ := os.ReadDir(Dir)
+	var ids []int
+	for _, de := range entries {
+		if id, err := strconv.Atoi(strings.TrimSuffix(de.Name(), ".json")); err == nil && strings.HasSuffix(de.Name(), ".json") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Find loads a run by ID.
+func Find(id string) (Entry, error) {
+	var e Entry
+	n, err := strconv.Atoi(id)
+	if err != nil || n <= 0 {
+		return e, fmt.Errorf("invalid run ID %q", id)
+	}
+	data, err := os.ReadFile(entryPath(n))
+	if os.IsNotExist(err) {
+		return e, fmt.Errorf("no run %d in history", n)
+	}
+	if err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(data, &e)
+	return e, err
+}
+
+// List returns up to limit runs, newest first; 0 means all.
+func List(limit int) []Entry {
+	ids := listIDs()
+	var list []Entry
+	for i := len(ids) - 1; i >= 0 && (limit <= 0 || len(list) < limit); i-- {
+		if e, err := Find(strconv.Itoa(ids[i])); err == nil {
+			list = append(list, e)
+		}
+	}
+	return list
+}
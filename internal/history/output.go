@@ -0,0 +1,87 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"neurader/internal/ssh"
+)
+
+// PrintList prints one line per run.
+func PrintList(list []Entry) {
+	if len(list) == 0 {
+		fmt.Println("No runs recorded.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tRESULT\tHOSTS OK/FAILED\tSTARTED\tDURATION\tOPERATOR\tTARGETS\tCOMMAND")
+	fmt.Fprintln(w, "--\t------\t---------------\t-------\t--------\t--------\t-------\t-------")
+	for _, e := range list {
+		ok, failed := e.Counts()
+		fmt.Fprintf(w, "%d\t%s\t%d/%d\t%s\t%s\t%s\t%s\t%s\n", e.ID, resultLabel(e), ok, failed,
+			e.Started.Local().Format("2006-01-02 15:04"), duration(e), e.Operator, strings.Join(e.Targets, ","), ssh.Truncate(e.Command, 40))
+	}
+	w.Flush()
+}
+
+// PrintEntry shows a run and its per-host results.
+func PrintEntry(e Entry) {
+	fmt.Printf("Run:      %d\n", e.ID)
+	fmt.Printf("Result:   %s\n", resultLabel(e))
+	fmt.Printf("Command:  %s\n", e.Command)
+	fmt.Printf("Targets:  %s\n", strings.Join(e.Targets, ","))
+	if e.RerunOf > 0 {
+		fmt.Printf("Rerun of: %d\n", e.RerunOf)
+	}
+	if e.Job != "" {
+		fmt.Printf("Job:      %s\n", e.Job)
+	}
+	fmt.Printf("Operator: %s\n", e.Operator)
+	fmt.Printf("Started:  %s (%s)\n", e.Started.Local().Format("2006-01-02 15:04:05"), duration(e))
+	if e.Error != "" {
+		fmt.Printf("Error:    %s%s%s\n", ssh.ColorRed, e.Error, ssh.ColorReset)
+	}
+	if len(e.Results) == 0 {
+		return
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tEXIT\tDURATION\tERROR")
+	fmt.Fprintln(w, "----\t------\t----\t--------\t-----")
+	for _, r := range e.Results {
+		color := ssh.ColorRed
+		if r.OK {
+			color = ssh.ColorGreen
+		}
+		exit := "-"
+		if r.ExitCode != nil {
+			exit = fmt.Sprint(*r.ExitCode)
+		}
+		errMsg := "-"
+		if r.Error != "" {
+			errMsg = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s%s%s\t%s\t%s\t%s\n", r.Host, color, r.Status, ssh.ColorReset, exit,
+			(time.Duration(r.DurationMS) * time.Millisecond).String(), errMsg)
+	}
+	w.Flush()
+}
+
+func resultLabel(e Entry) string {
+	_, failed := e.Counts()
+	switch {
+	case e.Error != "":
+		return ssh.ColorRed + "error" + ssh.ColorReset
+	case failed > 0:
+		return ssh.ColorRed + "failed" + ssh.ColorReset
+	}
+	return ssh.ColorGreen + "ok" + ssh.ColorReset
+}
+
+func duration(e Entry) string {
+	return e.Finished.Sub(e.Started).Round(time.Second).String()
+}
@@ -0,0 +1,259 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"neurader/internal/netutil"
+)
+
+/* ========================================================================
+   v2 INVENTORY
+   Shared hosts.yml model used by both the registration API and the SSH
+   executor. Hosts may belong to groups, and variables can be declared at
+   global, group and host scope.
+   ======================================================================== */
+
+const (
+	ConfigDir = "/etc/neurader"
+	Path      = "/etc/neurader/hosts.yml"
+)
+
+type HostEntry struct {
+	ID      string                 `yaml:"id,omitempty"`       // stable node ID, see system.EnsureNodeIdentity
+	NodeKey string                 `yaml:"node_key,omitempty"` // base64 ed25519 key the ID is derived from
+	Name    string                 `yaml:"name"`
+	IP      string                 `yaml:"ip"`
+	Addrs   []string               `yaml:"addrs,omitempty"` // extra addresses for dual-stack hosts
+	Via     string                 `yaml:"via,omitempty"`   // alias of the host this one is reached through
+	Groups  []string               `yaml:"groups,omitempty"`
+	Vars    map[string]interface{} `yaml:"vars,omitempty"`
+	Facts   map[string]interface{} `yaml:"facts,omitempty"`
+}
+
+type Group struct {
+	Hosts []string               `yaml:"hosts,omitempty"`
+	Vars  map[string]interface{} `yaml:"vars,omitempty"`
+}
+
+type Inventory struct {
+	Hosts  []HostEntry            `yaml:"hosts"`
+	Groups map[string]Group       `yaml:"groups,omitempty"`
+	Vars   map[string]interface{} `yaml:"vars,omitempty"`
+}
+
+// Load reads an inventory file. A missing or unreadable file yields an
+// empty inventory, matching how the CLI has always treated a fresh box.
+func Load(path string) Inventory {
+	var inv Inventory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return inv
+	}
+	_ = yaml.Unmarshal(data, &inv)
+	return inv
+}
+
+// Write persists an inventory file, creating the config directory if needed.
+func Write(path string, inv Inventory) error {
+	data, err := yaml.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(ConfigDir, 0755)
+	return os.WriteFile(path, data, 0644)
+}
+
+// Addresses lists every address the host can be reached on, primary
+// first. Dual-stack hosts carry their second family in Addrs.
+func (h HostEntry) Addresses() []string {
+	return append([]string{h.IP}, h.Addrs...)
+}
+
+// HasAddr reports whether addr is one of the host's addresses.
+func (h HostEntry) HasAddr(addr string) bool {
+	for _, a := range h.Addresses() {
+		if netutil.SameAddr(a, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key identifies a host: its node ID when it has one, otherwise its
+// primary address (manually added hosts and pre-identity children).
+func (h HostEntry) Key() string {
+	if h.ID != "" {
+		return h.ID
+	}
+	return h.IP
+}
+
+// RouteKey is Key qualified by the jump host, for anything tracked per
+// connection: hosts in different segments may share a private address.
+func (h HostEntry) RouteKey() string {
+	if h.Via != "" {
+		return h.Key() + "@" + h.Via
+	}
+	return h.Key()
+}
+
+// Find returns the host whose node ID, alias or address matches target.
+func (inv Inventory) Find(target string) (HostEntry, bool) {
+	for _, h := range inv.Hosts {
+		if h.Name == target || (h.ID != "" && h.ID == target) {
+			return h, true
+		}
+	}
+	for _, h := range inv.Hosts {
+		if h.HasAddr(target) {
+			return h, true
+		}
+	}
+	return HostEntry{}, false
+}
+
+// Route lists the hosts h is reached through, outermost first; it is
+// empty for hosts dialed directly. A via that names no inventory host or
+// loops back on itself is an error.
+func (inv Inventory) Route(h HostEntry) ([]HostEntry, error) {
+	var route []HostEntry
+	seen := map[string]bool{h.Name: true}
+	for h.Via != "" {
+		jump, ok := inv.Find(h.Via)
+		if !ok {
+			return nil, fmt.Errorf("host %s: via %q is not in the inventory", h.Name, h.Via)
+		}
+		if seen[jump.Name] {
+			return nil, fmt.Errorf("host %s: via %q loops back on itself", h.Name, h.Via)
+		}
+		seen[jump.Name] = true
+		route = append([]HostEntry{jump}, route...)
+		h = jump
+	}
+	return route, nil
+}
+
+// Validate checks every host address and jump route in the inventory.
+func (inv Inventory) Validate() error {
+	for _, h := range inv.Hosts {
+		for _, a := range h.Addresses() {
+			if _, err := netutil.Normalize(a); err != nil {
+				return fmt.Errorf("host %s: %v", h.Name, err)
+			}
+		}
+		if _, err := inv.Route(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InGroup reports whether h is a member of the named group, either through
+// its own groups list or the group's hosts list.
+func (inv Inventory) InGroup(h HostEntry, group string) bool {
+	if group == "all" {
+		return true
+	}
+	for _, g := range h.Groups {
+		if g == group {
+			return true
+		}
+	}
+	for _, member := range inv.Groups[group].Hosts {
+		if member == h.Name || h.HasAddr(member) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupsOf lists every group h belongs to, sorted by name.
+func (inv Inventory) GroupsOf(h HostEntry) []string {
+	seen := make(map[string]bool)
+	for _, g := range h.Groups {
+		seen[g] = true
+	}
+	for name := range inv.Groups {
+		if inv.InGroup(h, name) {
+			seen[name] = true
+		}
+	}
+	groups := make([]string, 0, len(seen))
+	for g := range seen {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Resolve expands a list of targets into hosts. "@group" selects every
+// member of a group ("@all" selects the whole inventory), an alias or IP
+// selects the matching entry, and anything else is treated as a bare
+// address so ad hoc IPs keep working. Duplicates are dropped.
+func (inv Inventory) Resolve(targets []string) ([]HostEntry, error) {
+	var hosts []HostEntry
+	seen := make(map[string]bool)
+	add := func(h HostEntry) {
+		// Hosts behind different jump hosts may share a private address
+		// and still be different machines.
+		key := h.RouteKey()
+		if !seen[key] {
+			seen[key] = true
+			hosts = append(hosts, h)
+		}
+	}
+
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if strings.HasPrefix(t, "@") {
+			group := strings.TrimPrefix(t, "@")
+			matched := false
+			for _, h := range inv.Hosts {
+				if inv.InGroup(h, group) {
+					add(h)
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("group %q has no hosts", group)
+			}
+			continue
+		}
+		if h, ok := inv.Find(t); ok {
+			add(h)
+			continue
+		}
+		ip := t
+		if n, err := netutil.Normalize(t); err == nil {
+			ip = n
+		}
+		add(HostEntry{Name: t, IP: ip})
+	}
+	return hosts, nil
+}
+
+// VarsFor merges variables for h with increasing precedence: global vars,
+// then group vars (groups applied in name order), then host vars.
+func (inv Inventory) VarsFor(h HostEntry) map[string]interface{} {
+	vars := make(map[string]interface{})
+	for k, v := range inv.Vars {
+		vars[k] = v
+	}
+	for _, g := range inv.GroupsOf(h) {
+		for k, v := range inv.Groups[g].Vars {
+			vars[k] = v
+		}
+	}
+	for k, v := range h.Vars {
+		vars[k] = v
+	}
+	return vars
+}
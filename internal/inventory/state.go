@@ -0,0 +1,154 @@
+package inventory
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* ========================================================================
+   PERSISTED HOST STATE
+   Runtime observations (last contact, errors, versions, sync state) live
+   in state.yml rather than hosts.yml so the operator-edited inventory is
+   never rewritten by status checks.
+   ======================================================================== */
+
+const StatePath = "/etc/neurader/state.yml"
+
+type HostState struct {
+	LastSeen    time.Time `yaml:"last_seen,omitempty"`
+	LastError   string    `yaml:"last_error,omitempty"`
+	LastErrorAt time.Time `yaml:"last_error_at,omitempty"`
+	LastRun     time.Time `yaml:"last_run,omitempty"`
+	Version     string    `yaml:"version,omitempty"`
+	Synced      bool      `yaml:"synced"`
+
+	// Failures holds the times of connection failures since the last
+	// successful contact; it drives the circuit breaker.
+	Failures []time.Time `yaml:"failures,omitempty"`
+}
+
+// maxFailures bounds how many failure times are kept per host.
+const maxFailures = 20
+
+// Seen records a successful contact at t, which also clears the failure
+// history.
+func (s *HostState) Seen(t time.Time) {
+	s.LastSeen = t
+	s.Failures = nil
+}
+
+// Failed records a failed contact at t.
+func (s *HostState) Failed(err error, t time.Time) {
+	s.LastError, s.LastErrorAt = err.Error(), t
+	s.Failures = append(s.Failures, t)
+	if len(s.Failures) > maxFailures {
+		s.Failures = s.Failures[len(s.Failures)-maxFailures:]
+	}
+}
+
+// Noted records an error at t that says nothing about SSH reachability,
+// such as a failed key handshake, so it is shown but not counted as a
+// failure.
+func (s *HostState) Noted(err error, t time.Time) {
+	s.LastError, s.LastErrorAt = err.Error(), t
+}
+
+// FailuresSince counts the recorded failures after t.
+func (s HostState) FailuresSince(t time.Time) int {
+	n := 0
+	for _, f := range s.Failures {
+		if f.After(t) {
+			n++
+		}
+	}
+	return n
+}
+
+type State struct {
+	Hosts map[string]HostState `yaml:"hosts"`
+}
+
+// stateMu serialises writers inside one process; the flock on the lock
+// file covers the daemon and CLI writing at the same time.
+var stateMu sync.Mutex
+
+// StateKey is the key a host's record is stored under in state.yml.
+// Keying on the node ID keeps history intact when a child changes address.
+func StateKey(h HostEntry) string {
+	return h.RouteKey()
+}
+
+// LoadState reads state.yml, returning an empty state if it is missing.
+func LoadState() State {
+	st := State{Hosts: map[string]HostState{}}
+	data, err := os.ReadFile(StatePath)
+	if err != nil {
+		return st
+	}
+	_ = yaml.Unmarshal(data, &st)
+	if st.Hosts == nil {
+		st.Hosts = map[string]HostState{}
+	}
+	return st
+}
+
+// UpdateState applies fn to the record for h and persists the result.
+func UpdateState(h HostEntry, fn func(*HostState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(StatePath+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	st := LoadState()
+	key := StateKey(h)
+	rec := st.Hosts[key]
+	fn(&rec)
+	st.Hosts[key] = rec
+
+	data, err := yaml.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, StatePath)
+}
+
+// MarkSeen records a successful contact with h.
+func MarkSeen(h HostEntry) {
+	_ = UpdateState(h, func(s *HostState) {
+		s.Seen(time.Now())
+	})
+}
+
+// MarkError records a failed contact with h.
+func MarkError(h HostEntry, err error) {
+	_ = UpdateState(h, func(s *HostState) {
+		s.Failed(err, time.Now())
+	})
+}
+
+// NoteError records an error with h that is not an SSH connection failure;
+// it does not feed the circuit breaker.
+func NoteError(h HostEntry, err error) {
+	_ = UpdateState(h, func(s *HostState) {
+		s.Noted(err, time.Now())
+	})
+}
@@ -0,0 +1,210 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"neurader/internal/control"
+	"neurader/internal/history"
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   DAEMON SIDE
+========================= */
+
+const (
+	opSubmit = "jobs.submit"
+	opCancel = "jobs.cancel"
+)
+
+type SubmitRequest struct {
+	Targets  []string       `json:"targets"`
+	Command  string         `json:"command"`
+	Options  ssh.RunOptions `json:"options"`
+	Operator string         `json:"operator"`
+}
+
+type SubmitReply struct {
+	ID    string `json:"id"`
+	Hosts int    `json:"hosts"`
+}
+
+type cancelRequest struct {
+	ID string `json:"id"`
+}
+
+var (
+	runningMu sync.Mutex
+	running   = map[string]context.CancelFunc{}
+)
+
+// Serve registers the job operations on the control socket. Jobs left
+// running by a previous daemon are marked interrupted first: their remote
+// commands were cut off when that daemon's connections closed.
+func Serve() {
+	for _, j := range List() {
+		if j.State == StateRunning {
+			j.State = StateInterrupted
+			j.Error = "the daemon stopped while the job was running"
+			j.Finished = time.Now()
+			_ = save(j)
+		}
+	}
+	control.Handle(opSubmit, handleSubmit)
+	control.Handle(opCancel, handleCancel)
+}
+
+func handleSubmit(conn *control.Conn, body json.RawMessage) {
+	var req SubmitRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		control.Reply(conn, nil, err)
+		return
+	}
+	reply, err := Start(req)
+	control.Reply(conn, reply, err)
+}
+
+func handleCancel(conn *control.Conn, body json.RawMessage) {
+	var req cancelRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		control.Reply(conn, nil, err)
+		return
+	}
+	runningMu.Lock()
+	cancel, ok := running[req.ID]
+	runningMu.Unlock()
+	if !ok {
+		control.Reply(conn, nil, fmt.Errorf("job %s is not running", req.ID))
+		return
+	}
+	cancel()
+	control.Reply(conn, struct{}{}, nil)
+}
+
+// Start validates req, persists the new job and runs it in the background.
+// It must be called inside the daemon.
+func Start(req SubmitRequest) (SubmitReply, error) {
+	cmds, err := ssh.RenderMulti(req.Targets, req.Command, req.Options.Templated)
+	if err != nil {
+		recordRun(Job{Command: req.Command, Targets: req.Targets, Options: req.Options, Operator: req.Operator, Created: time.Now()}, nil, err)
+		return SubmitReply{}, err
+	}
+
+	j := Job{
+		ID:       newID(),
+		Command:  req.Command,
+		Targets:  req.Targets,
+		Options:  req.Options,
+		Operator: req.Operator,
+		State:    StateRunning,
+		Created:  time.Now(),
+		Results:  []HostResult{},
+	}
+	if err := save(j); err != nil {
+		return SubmitReply{}, err
+	}
+	f, err := os.OpenFile(OutputPath(j.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return SubmitReply{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runningMu.Lock()
+	running[j.ID] = cancel
+	runningMu.Unlock()
+
+	go run(ctx, j, f)
+	fmt.Printf("[*] Job %s started by %s on %d host(s): %s\n", j.ID, j.Operator, len(cmds), j.Command)
+	return SubmitReply{ID: j.ID, Hosts: len(cmds)}, nil
+}
+
+// Running reports whether job id is still running in this daemon.
+func Running(id string) bool {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	_, ok := running[id]
+	return ok
+}
+
+func run(ctx context.Context, j Job, f *os.File) {
+	defer f.Close()
+	rec := &recorder{Output: ssh.NewJSONOutput(f), job: &j}
+	results, err := ssh.ExecuteRemoteMultiTo(ctx, rec, j.Targets, j.Command, j.Options)
+
+	runningMu.Lock()
+	cancel := running[j.ID]
+	delete(running, j.ID)
+	runningMu.Unlock()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	j.Finished = time.Now()
+	switch {
+	case err != nil:
+		j.State, j.Error = StateFailed, err.Error()
+	case ctx.Err() != nil:
+		j.State = StateCancelled
+	case ssh.AnyFailed(results):
+		j.State = StateFailed
+	default:
+		j.State = StateDone
+	}
+	if err == nil {
+		j.Results = j.Results[:0]
+		for _, r := range results {
+			j.Results = append(j.Results, history.NewHostResult(r))
+		}
+	}
+	if saveErr := save(j); saveErr != nil {
+		fmt.Printf("[!] Job %s: could not save state: %v\n", j.ID, saveErr)
+	}
+	recordRun(j, results, err)
+	cancel()
+	fmt.Printf("[*] Job %s finished: %s\n", j.ID, j.State)
+}
+
+// recordRun adds a job, scheduled or submitted with --async, to the run
+// history like any other run.
+func recordRun(j Job, results []ssh.Result, err error) {
+	e := history.Entry{Command: j.Command, Targets: j.Targets, Options: j.Options, Operator: j.Operator, Job: j.ID, Started: j.Created}
+	if _, herr := history.Record(e, results, err); herr != nil {
+		fmt.Printf("[!] Job %s: could not record it in history: %v\n", j.ID, herr)
+	}
+}
+
+// recorder persists each host's result as soon as it finishes, so
+// "job status" shows progress while the job runs.
+type recorder struct {
+	ssh.Output
+	mu  sync.Mutex
+	job *Job
+}
+
+func (r *recorder) Finish(res ssh.Result) {
+	r.Output.Finish(res)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Results = append(r.job.Results, history.NewHostResult(res))
+	_ = save(*r.job)
+}
+
+/* =========================
+   CLIENT SIDE
+========================= */
+
+// Submit hands a run to the daemon.
+func Submit(req SubmitRequest) (SubmitReply, error) {
+	var reply SubmitReply
+	err := control.Call(opSubmit, req, &reply)
+	return reply, err
+}
+
+// Cancel stops a running job; its remote commands are terminated.
+func Cancel(id string) error {
+	return control.Call(opCancel, cancelRequest{ID: id}, nil)
+}
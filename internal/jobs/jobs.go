@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"neurader/internal/history"
+	"neurader/internal/ssh"
+)
+
+/* ========================================================================
+   ASYNCHRONOUS JOBS
+   "run --async" hands a run to the daemon, which executes it detached
+   from the operator's terminal. Each job lives in its own directory under
+   Dir: job.json holds the spec, state and per-host results, output.jsonl
+   the run's events in the json output format. Both survive daemon
+   restarts; the CLI reads them directly.
+   ======================================================================== */
+
+const Dir = "/var/lib/neurader/jobs"
+
+// Job states.
+const (
+	StateRunning     = "running"
+	StateDone        = "done"        // every host succeeded
+	StateFailed      = "failed"      // at least one host failed, or the run could not start
+	StateCancelled   = "cancelled"   // stopped with "job cancel"
+	StateInterrupted = "interrupted" // the daemon stopped while the job was running
+)
+
+type Job struct {
+	ID       string         `json:"id"`
+	Command  string         `json:"command"`
+	Targets  []string       `json:"targets"`
+	Options  ssh.RunOptions `json:"options"`
+	Operator string         `json:"operator"`
+	State    string         `json:"state"`
+	Error    string         `json:"error,omitempty"`
+	Created  time.Time      `json:"created"`
+	Finished time.Time      `json:"finished,omitempty"`
+	Results  []HostResult   `json:"results"`
+}
+
+// The persisted result lives in internal/history so finished jobs can be
+// recorded there too; this alias keeps the existing jobs.* call sites
+// working.
+type HostResult = history.HostResult
+
+// Done reports whether the job has reached a final state.
+func (j Job) Done() bool {
+	return j.State != StateRunning
+}
+
+// Counts tallies the finished hosts.
+func (j Job) Counts() (ok, failed int) {
+	for _, r := range j.Results {
+		if r.OK {
+			ok++
+		} else {
+			failed++
+		}
+	}
+	return ok, failed
+}
+
+func jobDir(id string) string     { return filepath.Join(Dir, id) }
+func jobPath(id string) string    { return filepath.Join(jobDir(id), "job.json") }
+func OutputPath(id string) string { return filepath.Join(jobDir(id), "output.jsonl") }
+
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// save writes job.json atomically so readers never see a partial file.
+func save(j Job) error {
+	if err := os.MkdirAll(jobDir(j.ID), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := jobPath(j.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, jobPath(j.ID))
+}
+
+func load(id string) (Job, error) {
+	var j Job
+	data, err := os.ReadFile(jobPath(id))
+	if err != nil {
+		return j, err
+	}
+	err = json.Unmarshal(data, &j)
+	return j, err
+}
+
+// List returns every job, newest first.
+func List() []Job {
+	entries, _ := os.ReadDir(Dir)
+	var jobs []Job
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if j, err := load(e.Name()); err == nil {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Created.After(jobs[b].Created) })
+	return jobs
+}
+
+// Find loads a job by ID or unique ID prefix.
+func Find(id string) (Job, error) {
+	if j, err := load(id); err == nil {
+		return j, nil
+	}
+	var matches []Job
+	for _, j := range List() {
+		if strings.HasPrefix(j.ID, id) {
+			matches = append(matches, j)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Job{}, fmt.Errorf("no job %q", id)
+	case 1:
+		return matches[0], nil
+	}
+	return Job{}, fmt.Errorf("job ID %q is ambiguous (%d matches)", id, len(matches))
+}
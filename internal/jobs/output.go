@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"neurader/internal/control"
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   DISPLAY
+========================= */
+
+// event is the part of the json output format that PrintOutput replays.
+type event struct {
+	Type   string `json:"type"`
+	Host   string `json:"host"`
+	Line   string `json:"line"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// PrintOutput replays a job's output the way the stream output mode shows
+// a live run. With follow it keeps reading until the job has finished.
+func PrintOutput(j Job, follow bool) error {
+	f, err := os.Open(OutputPath(j.ID))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	partial := ""
+	finished := j.Done()
+	for {
+		line, err := r.ReadString('\n')
+		if err == nil {
+			printEvent(partial + line)
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		partial += line
+		if !follow || finished {
+			break
+		}
+		// Once the job is seen finished, one more pass drains whatever
+		// it wrote last.
+		time.Sleep(300 * time.Millisecond)
+		if cur, err := load(j.ID); err == nil {
+			j = cur
+			finished = cur.Done()
+		}
+		// A job left running is only marked interrupted when the next
+		// daemon starts, so without this the wait would never end.
+		if !finished && !control.Running() {
+			if cur, err := load(j.ID); err != nil || !cur.Done() {
+				return fmt.Errorf("the daemon is not running: job %s will never finish (it is marked interrupted when the daemon next starts)", j.ID)
+			}
+			finished = true
+		}
+	}
+
+	if j, err = load(j.ID); err == nil && j.Done() {
+		fmt.Println()
+		PrintResults(j)
+	}
+	return nil
+}
+
+func printEvent(line string) {
+	var ev event
+	if json.Unmarshal([]byte(line), &ev) != nil {
+		return
+	}
+	switch ev.Type {
+	case "info":
+		fmt.Println(ev.Line)
+	case "line":
+		fmt.Printf("[%s] %s\n", ev.Host, ev.Line)
+	case "result":
+		if ev.Error != "" {
+			fmt.Printf("[%s] %sError%s: %s\n", ev.Host, ssh.ColorRed, ssh.ColorReset, ev.Error)
+		}
+	}
+}
+
+// PrintStatus shows a job's details and per-host results.
+func PrintStatus(j Job) {
+	fmt.Printf("Job:      %s\n", j.ID)
+	fmt.Printf("State:    %s\n", stateLabel(j.State))
+	fmt.Printf("Command:  %s\n", j.Command)
+	fmt.Printf("Targets:  %s\n", strings.Join(j.Targets, ","))
+	fmt.Printf("Operator: %s\n", j.Operator)
+	fmt.Printf("Started:  %s\n", j.Created.Local().Format("2006-01-02 15:04:05"))
+	if j.Done() {
+		fmt.Printf("Finished: %s (%s)\n", j.Finished.Local().Format("2006-01-02 15:04:05"), duration(j))
+	} else {
+		fmt.Printf("Running:  %s\n", duration(j))
+	}
+	if j.Error != "" {
+		fmt.Printf("Error:    %s%s%s\n", ssh.ColorRed, j.Error, ssh.ColorReset)
+	}
+	fmt.Println()
+	PrintResults(j)
+}
+
+// PrintResults prints the per-host table of a job.
+func PrintResults(j Job) {
+	if len(j.Results) == 0 {
+		fmt.Println("No hosts have finished yet.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tEXIT\tDURATION\tERROR")
+	fmt.Fprintln(w, "----\t------\t----\t--------\t-----")
+	for _, r := range j.Results {
+		color := ssh.ColorRed
+		if r.OK {
+			color = ssh.ColorGreen
+		}
+		exit := "-"
+		if r.ExitCode != nil {
+			exit = fmt.Sprint(*r.ExitCode)
+		}
+		errMsg := "-"
+		if r.Error != "" {
+			errMsg = r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s%s%s\t%s\t%s\t%s\n", r.Host, color, r.Status, ssh.ColorReset, exit,
+			(time.Duration(r.DurationMS) * time.Millisecond).String(), errMsg)
+	}
+	w.Flush()
+}
+
+// PrintList shows all jobs, newest first.
+func PrintList(jobs []Job) {
+	if len(jobs) == 0 {
+		fmt.Println("No jobs.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tHOSTS OK/FAILED\tSTARTED\tDURATION\tOPERATOR\tCOMMAND")
+	fmt.Fprintln(w, "--\t-----\t---------------\t-------\t--------\t--------\t-------")
+	for _, j := range jobs {
+		ok, failed := j.Counts()
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\t%s\n", j.ID, stateLabel(j.State), ok, failed,
+			j.Created.Local().Format("2006-01-02 15:04"), duration(j), j.Operator, ssh.Truncate(j.Command, 40))
+	}
+	w.Flush()
+}
+
+func stateLabel(state string) string {
+	color := ssh.ColorRed
+	switch state {
+	case StateDone:
+		color = ssh.ColorGreen
+	case StateRunning:
+		color = ssh.ColorYellow
+	}
+	return color + state + ssh.ColorReset
+}
+
+func duration(j Job) string {
+	end := j.Finished
+	if !j.Done() {
+		end = time.Now()
+	}
+	return end.Sub(j.Created).Round(time.Second).String()
+}
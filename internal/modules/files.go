@@ -0,0 +1,225 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* =========================
+   FILE, LINEINFILE, DIRECTORY
+========================= */
+
+func init() {
+	register(Module{
+		Name:    "file",
+		Summary: "make sure a file exists with the given content and permissions, or is absent",
+		Params: []Param{
+			{Name: "path", Required: true, Pattern: absPath, Help: "absolute path"},
+			{Name: "state", Default: "file", Choices: []string{"file", "absent", "touch"}},
+			{Name: "content", Help: "exact file content; without it the file must already exist"},
+			{Name: "mode", Pattern: octalMode, Help: "octal permissions, e.g. 0644"},
+			{Name: "owner"},
+			{Name: "group"},
+			{Name: "backup", Default: "no", Choices: yesNo, Help: "keep a timestamped copy of the file being replaced"},
+			{Name: "validate", Help: "command checking new content, e.g. \"visudo -cf %s\": %s is the new file before it is put in place; without %s it runs once the file is in place and a failure puts the old one back"},
+		},
+		script: fileScript,
+		stdin:  "content",
+	})
+	register(Module{
+		Name:    "lineinfile",
+		Summary: "make sure a line is present in, or absent from, a text file",
+		Params: []Param{
+			{Name: "path", Required: true, Pattern: absPath, Help: "absolute path"},
+			{Name: "line", Help: "the line to ensure, without a newline"},
+			{Name: "regexp", Help: "extended regexp selecting the lines to replace (present) or delete (absent)"},
+			{Name: "state", Default: "present", Choices: []string{"present", "absent"}},
+			{Name: "create", Default: "no", Choices: yesNo, Help: "create the file if it is missing"},
+		},
+		script: lineInFileScript,
+	})
+	register(Module{
+		Name:    "directory",
+		Summary: "make sure a directory exists with the given permissions, or is absent",
+		Params: []Param{
+			{Name: "path", Required: true, Pattern: absPath, Help: "absolute path"},
+			{Name: "state", Default: "present", Choices: []string{"present", "absent"}},
+			{Name: "mode", Pattern: octalMode, Help: "octal permissions, e.g. 0755"},
+			{Name: "owner"},
+			{Name: "group"},
+		},
+		script: directoryScript,
+	})
+}
+
+func fileScript(a Args) (string, error) {
+	_, hasContent := a["content"]
+	if a["validate"] != "" && !hasContent {
+		return "", fmt.Errorf("validate needs content")
+	}
+	// The content arrives on stdin. A validate command naming the file
+	// with %s gets the new file as $1, before it replaces the old one.
+	validate, validateFirst := a["validate"], strings.Contains(a["validate"], "%s")
+	if validateFirst {
+		validate = strings.ReplaceAll(validate, "%s", `"$1"`)
+	}
+	return fmt.Sprintf(`path=%s
+state=%s
+has_content=%t
+mode=%s
+owner=%s
+group=%s
+backup=%s
+validate=%s
+validate_first=%t
+validate_label=%s
+`, q(a["path"]), q(a["state"]), hasContent, q(a["mode"]), q(a["owner"]), q(a["group"]), q(a["backup"]), q(validate), validateFirst, q(a["validate"])) + `
+[ -d "$path" ] && [ ! -L "$path" ] && nr_fail "$path is a directory (use the directory module)"
+
+case $state in
+absent)
+	if [ -e "$path" ] || [ -L "$path" ]; then
+		nr_diff "$path" "$path" /dev/null
+		if nr_change "remove $path"; then rm -f "$path" || exit 1; fi
+	fi
+	;;
+touch)
+	if nr_change "touch $path"; then touch "$path" || exit 1; fi
+	nr_attrs "$path" "$mode" "$owner" "$group"
+	;;
+file)
+	if [ "$has_content" = true ]; then
+		want=$(mktemp) || exit 1
+		old=$(mktemp) || exit 1
+		# Write beside the target and rename, so readers never see a
+		# half-written file.
+		tmp="$path.neurader.$$"
+		trap 'rm -f "$want" "$old" "$tmp"' EXIT
+		cat > "$want" || exit 1
+		if ! cmp -s "$want" "$path"; then
+			verb=write
+			[ -e "$path" ] || verb=create
+			nr_diff "$path" "$path" "$want"
+			if nr_change "$verb $path"; then
+				cat "$want" > "$tmp" || exit 1
+				if [ -e "$path" ]; then
+					chmod "$(stat -c %a "$path")" "$tmp"
+					chown "$(stat -c %u:%g "$path")" "$tmp" 2>/dev/null
+				fi
+				if [ "$validate_first" = true ] && ! sh -c "$validate" nr_validate "$tmp"; then
+					nr_fail "validation failed: $validate_label ($path left unchanged)"
+				fi
+				[ ! -e "$path" ] || cp -p "$path" "$old" || exit 1
+				mv -f "$tmp" "$path" || exit 1
+				if [ "$validate_first" = false ] && [ -n "$validate" ] && ! sh -c "$validate"; then
+					if [ "$verb" = write ]; then
+						mv -f "$old" "$path"
+						nr_fail "validation failed: $validate_label (previous $path restored)"
+					fi
+					rm -f "$path"
+					nr_fail "validation failed: $validate_label (new $path removed)"
+				fi
+				if [ "$verb" = write ] && [ "$backup" = yes ]; then
+					saved="$path.$(date +%Y%m%d%H%M%S).bak"
+					cp -p "$old" "$saved" || nr_fail "could not back up $path"
+					echo "backed up the previous version to $saved"
+				fi
+			fi
+		fi
+	elif [ ! -e "$path" ]; then
+		nr_fail "$path does not exist (set content, or state=touch)"
+	fi
+	nr_attrs "$path" "$mode" "$owner" "$group"
+	;;
+esac`, nil
+}
+
+func lineInFileScript(a Args) (string, error) {
+	_, hasLine := a["line"]
+	switch {
+	case a["state"] == "present" && !hasLine:
+		return "", fmt.Errorf("line is required with state=present")
+	case a["state"] == "absent" && !hasLine && a["regexp"] == "":
+		return "", fmt.Errorf("line or regexp is required with state=absent")
+	}
+
+	// awk reads the line and regexp from the environment: -v would
+	// interpret backslashes in them.
+	return fmt.Sprintf(`path=%s
+NR_LINE=%s
+NR_RE=%s
+state=%s
+create=%s
+export NR_LINE NR_RE
+`, q(a["path"]), q(a["line"]), q(a["regexp"]), q(a["state"]), q(a["create"])) + `
+if [ ! -e "$path" ]; then
+	if [ "$state" = absent ]; then nr_done; fi
+	[ "$create" = yes ] || nr_fail "$path does not exist (set create=yes to create it)"
+	if nr_change "create $path"; then : > "$path" || exit 1; fi
+fi
+[ -f "$path" ] || [ ! -e "$path" ] || nr_fail "$path is not a regular file"
+
+new=$(mktemp) || exit 1
+trap 'rm -f "$new"' EXIT
+
+if [ -e "$path" ]; then
+	if [ "$state" = present ]; then
+		awk 'BEGIN { line = ENVIRON["NR_LINE"]; re = ENVIRON["NR_RE"] }
+			{ if (re != "" && $0 ~ re) { print line; found = 1 } else { if ($0 == line) found = 1; print } }
+			END { if (!found) print line }' "$path" > "$new" || exit 1
+	else
+		awk 'BEGIN { line = ENVIRON["NR_LINE"]; re = ENVIRON["NR_RE"] }
+			{ if (re != "" ? $0 ~ re : $0 == line) next; print }' "$path" > "$new" || exit 1
+	fi
+elif [ "$state" = present ]; then
+	printf '%s\n' "$NR_LINE" > "$new"
+fi
+
+# awk terminates the last line; don't count that alone as a change.
+if [ -e "$path" ] && [ -s "$path" ] && [ -n "$(tail -c 1 "$path")" ]; then
+	cur=$(mktemp) || exit 1
+	trap 'rm -f "$new" "$cur"' EXIT
+	cat "$path" > "$cur"
+	echo >> "$cur"
+else
+	cur=$path
+fi
+
+if [ ! -e "$path" ]; then
+	# Only in check mode: the file would have been created above.
+	nr_diff "$path" /dev/null "$new"
+elif ! cmp -s "$new" "$cur"; then
+	nr_diff "$path" "$path" "$new"
+	if [ "$state" = present ]; then msg="set line in $path"; else msg="remove line from $path"; fi
+	# Rewriting in place keeps the file's owner, mode and links.
+	if nr_change "$msg"; then cat "$new" > "$path" || exit 1; fi
+fi`, nil
+}
+
+func directoryScript(a Args) (string, error) {
+	if a["state"] == "absent" && a["path"] == "/" {
+		return "", fmt.Errorf("refusing to remove /")
+	}
+	return fmt.Sprintf(`path=%s
+state=%s
+mode=%s
+owner=%s
+group=%s
+`, q(a["path"]), q(a["state"]), q(a["mode"]), q(a["owner"]), q(a["group"])) + `
+case $state in
+absent)
+	if [ -e "$path" ] || [ -L "$path" ]; then
+		[ -d "$path" ] && [ ! -L "$path" ] || nr_fail "$path is not a directory"
+		if nr_change "remove $path"; then rm -rf -- "$path" || exit 1; fi
+	fi
+	;;
+present)
+	if [ ! -e "$path" ]; then
+		if nr_change "create $path"; then mkdir -p -- "$path" || exit 1; fi
+	elif [ ! -d "$path" ]; then
+		nr_fail "$path exists and is not a directory"
+	fi
+	nr_attrs "$path" "$mode" "$owner" "$group"
+	;;
+esac`, nil
+}
@@ -0,0 +1,334 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"neurader/internal/ssh"
+)
+
+/* ========================================================================
+   BUILT-IN MODULES
+   A module turns key=value arguments into a self-contained POSIX shell
+   script that brings one aspect of a host to the requested state (a
+   package installed, a service running, a line in a file) and reports
+   whether anything had to change. Scripts test before they act, so
+   running a module twice changes nothing the second time. In check mode
+   the same tests run but every action is skipped and reported as what
+   would have been done. In diff mode each change is also shown as a
+   unified diff of the file content, package set or service state, before
+   and after.
+   ======================================================================== */
+
+// Marker starts the status line a module script prints last. It is
+// filtered from displayed output and parsed from the result.
+const Marker = "::neurader::"
+
+// DiffMarker starts every line of diff output, so it can be told apart
+// from what the commands themselves print.
+const DiffMarker = "::neurader-diff::"
+
+// Outcomes reported by a module script.
+const (
+	Changed   = "changed"
+	Unchanged = "ok"
+)
+
+// Options select how a module script runs.
+type Options struct {
+	Check bool // only report what would change
+	Diff  bool // show a diff of every change
+}
+
+// Args are a module's arguments, by name.
+type Args map[string]string
+
+// Param describes one argument a module accepts.
+type Param struct {
+	Name     string
+	Required bool
+	Default  string
+	Choices  []string       // allowed values, if restricted
+	Pattern  *regexp.Regexp // allowed syntax, if restricted
+	Help     string
+}
+
+type Module struct {
+	Name    string
+	Summary string
+	Params  []Param
+	script  func(a Args) (string, error) // body run after the prelude
+
+	// stdin names an argument sent to the script on stdin rather than in
+	// the command, which the kernel limits to about 128KB an argument.
+	stdin string
+}
+
+var registry = map[string]Module{}
+
+func register(m Module) {
+	registry[m.Name] = m
+}
+
+// Names lists the available modules, sorted.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the named module.
+func Lookup(name string) (Module, bool) {
+	m, ok := registry[name]
+	return m, ok
+}
+
+// Shared argument syntax.
+var (
+	yesNo       = []string{"yes", "no"}
+	absPath     = regexp.MustCompile(`^/.*[^/]$|^/$`)
+	octalMode   = regexp.MustCompile(`^0?[0-7]{3,4}$`)
+	accountName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*\$?$`)
+	numericID   = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// ParseArgs turns "key=value" words into Args.
+func ParseArgs(words []string) (Args, error) {
+	args := Args{}
+	for _, w := range words {
+		k, v, ok := strings.Cut(w, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid argument %q (want key=value)", w)
+		}
+		args[k] = v
+	}
+	return args, nil
+}
+
+// normalize checks args against the module's parameters and fills in
+// defaults. Booleans are accepted as yes/no or true/false.
+func (m Module) normalize(args Args) (Args, error) {
+	known := map[string]Param{}
+	for _, p := range m.Params {
+		known[p.Name] = p
+	}
+	out := Args{}
+	for k, v := range args {
+		p, ok := known[k]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown argument %q (accepted: %s)", m.Name, k, strings.Join(m.paramNames(), ", "))
+		}
+		if len(p.Choices) > 0 && p.Choices[0] == "yes" {
+			switch strings.ToLower(v) {
+			case "true", "yes", "on", "1":
+				v = "yes"
+			case "false", "no", "off", "0":
+				v = "no"
+			}
+		}
+		out[k] = v
+	}
+	for _, p := range m.Params {
+		v, ok := out[p.Name]
+		if !ok || v == "" {
+			if p.Required {
+				return nil, fmt.Errorf("%s: %s is required", m.Name, p.Name)
+			}
+			if p.Default == "" {
+				continue
+			}
+			v = p.Default
+			out[p.Name] = v
+		}
+		if len(p.Choices) > 0 && !contains(p.Choices, v) {
+			return nil, fmt.Errorf("%s: %s must be one of %s", m.Name, p.Name, strings.Join(p.Choices, ", "))
+		}
+		if p.Pattern != nil && !p.Pattern.MatchString(v) {
+			return nil, fmt.Errorf("%s: invalid %s %q", m.Name, p.Name, v)
+		}
+	}
+	return out, nil
+}
+
+func (m Module) paramNames() []string {
+	names := make([]string, len(m.Params))
+	for i, p := range m.Params {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Script validates args and returns the remote command for the module,
+// with what must be fed to it on stdin, if anything.
+func Script(name string, args Args, o Options) (string, []byte, error) {
+	m, ok := registry[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown module %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	args, err := m.normalize(args)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := m.script(args)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", m.Name, err)
+	}
+	var stdin []byte
+	if v, ok := args[m.stdin]; ok && m.stdin != "" {
+		stdin = append([]byte{}, v...)
+	}
+	return fmt.Sprintf("NR_CHECK=%d\nNR_DIFF=%d\n", flag(o.Check), flag(o.Diff)) + prelude + body + "\nnr_done\n", stdin, nil
+}
+
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// prelude defines the helpers every module body uses:
+//
+//	nr_change MSG   record a change; false in check mode, so the action
+//	                guarded by it is skipped
+//	nr_fail MSG     report an error and exit 1
+//	nr_done         print the status line and exit 0
+//	nr_entry DB KEY look up a passwd/group entry, with or without getent
+//	nr_attrs PATH MODE OWNER GROUP   converge permissions and ownership
+//	nr_diff LABEL OLD NEW       in diff mode, diff two files (missing = empty)
+//	nr_diff_text LABEL OLD NEW  the same for two strings
+const prelude = `nr_changed=0
+nr_change() {
+	nr_changed=1
+	if [ "$NR_CHECK" = 1 ]; then
+		echo "would $*"
+		return 1
+	fi
+	echo "$*"
+}
+nr_fail() {
+	echo "$*" >&2
+	exit 1
+}
+nr_done() {
+	if [ "$nr_changed" = 1 ]; then
+		echo "` + Marker + ` ` + Changed + `"
+	else
+		echo "` + Marker + ` ` + Unchanged + `"
+	fi
+	exit 0
+}
+nr_entry() {
+	getent "$1" "$2" 2>/dev/null || grep "^$2:" "/etc/$1" 2>/dev/null
+}
+nr_attrs() {
+	if [ -n "$2" ] && [ "$(stat -c %a "$1" 2>/dev/null)" != "$(echo "$2" | sed 's/^0*//')" ]; then
+		if nr_change "chmod $2 $1"; then chmod "$2" "$1" || exit 1; fi
+	fi
+	if [ -n "$3" ] && [ "$(stat -c %U "$1" 2>/dev/null)" != "$3" ] && [ "$(stat -c %u "$1" 2>/dev/null)" != "$3" ]; then
+		if nr_change "chown $3 $1"; then chown "$3" "$1" || exit 1; fi
+	fi
+	if [ -n "$4" ] && [ "$(stat -c %G "$1" 2>/dev/null)" != "$4" ] && [ "$(stat -c %g "$1" 2>/dev/null)" != "$4" ]; then
+		if nr_change "chgrp $4 $1"; then chgrp "$4" "$1" || exit 1; fi
+	fi
+}
+nr_diff() {
+	[ "$NR_DIFF" = 1 ] || return 0
+	nr_old=$2
+	nr_new=$3
+	[ -e "$nr_old" ] || nr_old=/dev/null
+	[ -e "$nr_new" ] || nr_new=/dev/null
+	if ! command -v diff >/dev/null 2>&1; then
+		echo "` + DiffMarker + `(no diff command on this host)"
+		return 0
+	fi
+	diff -u -L "$1 (before)" -L "$1 (after)" "$nr_old" "$nr_new" | sed 's/^/` + DiffMarker + `/'
+}
+nr_diff_text() {
+	[ "$NR_DIFF" = 1 ] && [ "$2" != "$3" ] || return 0
+	nr_a=$(mktemp) && nr_b=$(mktemp) || return 0
+	[ -z "$2" ] || printf '%s\n' "$2" > "$nr_a"
+	[ -z "$3" ] || printf '%s\n' "$3" > "$nr_b"
+	nr_diff "$1" "$nr_a" "$nr_b"
+	rm -f "$nr_a" "$nr_b"
+}
+`
+
+// q shell-quotes a module argument for the script.
+func q(s string) string {
+	return ssh.ShellQuote(s)
+}
+
+/* =========================
+   RESULTS
+========================= */
+
+// Outcome reads the status line from a module's output: Changed,
+// Unchanged, or "" if the script never got that far.
+// Lines are split by hand rather than scanned, as diffs and package
+// manager output can hold lines of any length.
+func Outcome(stdout []byte) string {
+	lines := bytes.Split(stdout, []byte("\n"))
+	for i := len(lines) - 1; i >= 0; i-- {
+		if rest, ok := bytes.CutPrefix(lines[i], []byte(Marker+" ")); ok {
+			return strings.TrimSpace(string(rest))
+		}
+	}
+	return ""
+}
+
+// StripStatus removes the status line and any diff from a module's
+// output, leaving the messages describing what it did.
+func StripStatus(stdout []byte) []byte {
+	var kept [][]byte
+	for _, line := range bytes.SplitAfter(stdout, []byte("\n")) {
+		if !bytes.HasPrefix(line, []byte(Marker)) && !bytes.HasPrefix(line, []byte(DiffMarker)) {
+			kept = append(kept, line)
+		}
+	}
+	return bytes.Join(kept, nil)
+}
+
+// FilterOutput hides module status lines from out and colours diffs.
+func FilterOutput(out ssh.Output) ssh.Output {
+	return filtered{out}
+}
+
+type filtered struct{ ssh.Output }
+
+func (f filtered) Line(host ssh.HostEntry, stream, line string) {
+	if stream == "stdout" && strings.HasPrefix(line, Marker) {
+		return
+	}
+	if d, ok := strings.CutPrefix(line, DiffMarker); ok && stream == "stdout" {
+		line = diffColor(d) + d + ssh.ColorReset
+	}
+	f.Output.Line(host, stream, line)
+}
+
+func diffColor(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+"):
+		return ssh.ColorGreen
+	case strings.HasPrefix(line, "-"):
+		return ssh.ColorRed
+	case strings.HasPrefix(line, "@@"):
+		return ssh.ColorYellow
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package modules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutcome(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	tests := []struct {
+		name, stdout, want string
+	}{
+		{"changed", "installing\n" + Marker + " " + Changed + "\n", Changed},
+		{"unchanged", Marker + " " + Unchanged + "\n", Unchanged},
+		{"no trailing newline", "ok\n" + Marker + " " + Changed, Changed},
+		{"long diff line", DiffMarker + "+" + long + "\n" + Marker + " " + Changed + "\n", Changed},
+		{"last status wins", Marker + " " + Unchanged + "\n" + Marker + " " + Changed + "\n", Changed},
+		{"no status", "error: no such package\n", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Outcome([]byte(tt.stdout)); got != tt.want {
+			t.Errorf("%s: Outcome = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStripStatus(t *testing.T) {
+	stdout := "created /etc/app\n" + DiffMarker + "+line\n" + Marker + " " + Changed + "\n"
+	if got := string(StripStatus([]byte(stdout))); got != "created /etc/app\n" {
+		t.Errorf("StripStatus = %q", got)
+	}
+}
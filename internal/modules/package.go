@@ -0,0 +1,152 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/* =========================
+   PACKAGE
+========================= */
+
+// packageName is what package managers accept as a plain name. Versions
+// ("nginx=1.24") are left out: they can't be checked idempotently
+// across managers.
+var packageName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+:-]*$`)
+
+func init() {
+	register(Module{
+		Name:    "package",
+		Summary: "install, remove or upgrade packages with apt, dnf, yum or apk",
+		Params: []Param{
+			{Name: "name", Required: true, Help: "package name, or several separated by commas"},
+			{Name: "state", Default: "present", Choices: []string{"present", "absent", "latest"}},
+			{Name: "update_cache", Default: "no", Choices: yesNo, Help: "refresh the package index first"},
+		},
+		script: packageScript,
+	})
+}
+
+func packageScript(a Args) (string, error) {
+	var pkgs []string
+	for _, p := range strings.Split(a["name"], ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !packageName.MatchString(p) {
+			return "", fmt.Errorf("invalid package name %q", p)
+		}
+		pkgs = append(pkgs, p)
+	}
+	if len(pkgs) == 0 {
+		return "", fmt.Errorf("name is required")
+	}
+
+	return fmt.Sprintf(`pkgs=%s
+state=%s
+update_cache=%s
+`, q(strings.Join(pkgs, " ")), q(a["state"]), q(a["update_cache"])) + `
+if command -v apt-get >/dev/null 2>&1; then mgr=apt
+elif command -v dnf >/dev/null 2>&1; then mgr=dnf
+elif command -v yum >/dev/null 2>&1; then mgr=yum
+elif command -v apk >/dev/null 2>&1; then mgr=apk
+else nr_fail "no supported package manager (apt, dnf, yum or apk)"
+fi
+
+installed() {
+	case $mgr in
+	apt) dpkg-query -W -f='${Status}' "$1" 2>/dev/null | grep -q 'install ok installed' ;;
+	dnf|yum) rpm -q "$1" >/dev/null 2>&1 ;;
+	apk) apk info -e "$1" >/dev/null 2>&1 ;;
+	esac
+}
+upgradable() {
+	case $mgr in
+	apt) apt-get -s install --only-upgrade "$1" 2>/dev/null | grep -q "^Inst $1 " ;;
+	dnf|yum) $mgr -q check-update "$1" >/dev/null 2>&1; [ $? -eq 100 ] ;;
+	apk) apk version -l '<' "$1" 2>/dev/null | grep -q "^$1-" ;;
+	esac
+}
+version() {
+	case $mgr in
+	apt) dpkg-query -W -f='${Version}' "$1" 2>/dev/null ;;
+	dnf|yum) rpm -q --qf '%{VERSION}-%{RELEASE}' "$1" 2>/dev/null ;;
+	apk) apk info -e -v "$1" 2>/dev/null | sed "s/^$1-//" ;;
+	esac
+}
+pm() {
+	action=$1
+	shift
+	case $mgr:$action in
+	apt:install) DEBIAN_FRONTEND=noninteractive apt-get install -y -q "$@" ;;
+	apt:upgrade) DEBIAN_FRONTEND=noninteractive apt-get install -y -q --only-upgrade "$@" ;;
+	apt:remove) DEBIAN_FRONTEND=noninteractive apt-get remove -y -q "$@" ;;
+	apt:refresh) apt-get update -q ;;
+	dnf:install|yum:install) $mgr install -y -q "$@" ;;
+	dnf:upgrade|yum:upgrade) $mgr upgrade -y -q "$@" ;;
+	dnf:remove|yum:remove) $mgr remove -y -q "$@" ;;
+	dnf:refresh|yum:refresh) $mgr makecache -q ;;
+	apk:install) apk add -q "$@" ;;
+	apk:upgrade) apk add -q -u "$@" ;;
+	apk:remove) apk del -q "$@" ;;
+	apk:refresh) apk update -q ;;
+	esac
+}
+
+# Refreshing the index changes no configuration, so it isn't reported as
+# a change, but check mode still leaves it alone.
+if [ "$update_cache" = yes ] && [ "$NR_CHECK" != 1 ]; then
+	pm refresh || nr_fail "could not refresh the package index"
+fi
+
+missing=
+present=
+stale=
+for p in $pkgs; do
+	if installed "$p"; then
+		present="$present $p"
+		if [ "$state" = latest ] && upgradable "$p"; then stale="$stale $p"; fi
+	else
+		missing="$missing $p"
+	fi
+done
+
+# The requested packages as installed now, and as they will be.
+before=
+after=
+for p in $pkgs; do
+	now=
+	installed "$p" && now="$p $(version "$p")"
+	want=$now
+	case $state in
+	absent) want= ;;
+	*) case " $missing " in *" $p "*) want="$p (new)" ;; esac
+	   case " $stale " in *" $p "*) want="$p (latest)" ;; esac ;;
+	esac
+	before="$before${now:+$now
+}"
+	after="$after${want:+$want
+}"
+done
+nr_diff_text packages "${before%
+}" "${after%
+}"
+
+case $state in
+present|latest)
+	if [ -n "$missing" ]; then
+		if nr_change "install$missing"; then pm install $missing || exit 1; fi
+	fi
+	if [ -n "$stale" ]; then
+		if nr_change "upgrade$stale"; then pm upgrade $stale || exit 1; fi
+	fi
+	;;
+absent)
+	if [ -n "$present" ]; then
+		if nr_change "remove$present"; then pm remove $present || exit 1; fi
+	fi
+	;;
+esac`, nil
+}
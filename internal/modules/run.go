@@ -0,0 +1,158 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"neurader/internal/inventory"
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   AD HOC MODULE RUNS
+========================= */
+
+// Run applies a module to every target. Argument values are rendered per
+// host as templates when opts.Templated is set, like "run" commands.
+func Run(ctx context.Context, targets []string, name string, args Args, mo Options, opts ssh.RunOptions) ([]ssh.Result, error) {
+	if _, ok := Lookup(name); !ok {
+		return nil, fmt.Errorf("unknown module %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	templated := false
+	for _, v := range args {
+		templated = templated || (opts.Templated && strings.Contains(v, "{{"))
+	}
+	if !templated {
+		// Same script everywhere: report bad arguments once, up front.
+		if _, _, err := Script(name, args, mo); err != nil {
+			return nil, err
+		}
+	}
+
+	inv := inventory.Load(inventory.Path)
+	hosts, err := inv.Resolve(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts matched %v", targets)
+	}
+
+	cmds := make([]ssh.RenderedCommand, len(hosts))
+	for i, h := range hosts {
+		cmds[i] = ssh.RenderedCommand{Host: h}
+		hostArgs := args
+		if templated {
+			if hostArgs, err = RenderArgs(args, ssh.TemplateData(inv, h)); err != nil {
+				cmds[i].Err = err
+				continue
+			}
+		}
+		cmds[i].Command, cmds[i].Stdin, cmds[i].Err = Script(name, hostArgs, mo)
+	}
+	return execute(ctx, name, cmds, mo.Check, opts)
+}
+
+// execute runs module scripts and reads their outcomes, summarising
+// with PrintResults under the given label.
+func execute(ctx context.Context, label string, cmds []ssh.RenderedCommand, check bool, opts ssh.RunOptions) ([]ssh.Result, error) {
+	out, err := ssh.NewOutput(opts.Output)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Output != "json" {
+		// JSON consumers get the status lines in the event stream instead.
+		out = &moduleOutput{filtered{out}, label, check}
+	}
+	results, err := ssh.ExecuteCommands(ctx, out, cmds, opts)
+	for i, r := range results {
+		if r.OK() && Outcome(r.Stdout) == "" {
+			results[i].Err = fmt.Errorf("module reported no status")
+		}
+	}
+	return results, err
+}
+
+// RenderArgs renders every argument value as a template against data.
+func RenderArgs(args Args, data map[string]interface{}) (Args, error) {
+	out := make(Args, len(args))
+	for k, v := range args {
+		r, err := ssh.Render(v, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		out[k] = r
+	}
+	return out, nil
+}
+
+// moduleOutput replaces the run summary with one that says which hosts
+// changed.
+type moduleOutput struct {
+	filtered
+	module string
+	check  bool
+}
+
+func (o *moduleOutput) Close(results []ssh.Result) {
+	PrintResults(o.module, results, o.check)
+}
+
+// PrintResults prints a per-host table of module outcomes and a tally.
+func PrintResults(module string, results []ssh.Result, check bool) {
+	changedLabel := Changed
+	if check {
+		changedLabel = "would change"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tDURATION\tERROR")
+	fmt.Fprintln(w, "----\t------\t--------\t-----")
+	changed, unchanged, failed := 0, 0, 0
+	for _, r := range results {
+		status, color := r.Status(), ssh.ColorRed
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		} else if !r.OK() {
+			errMsg = strings.TrimSpace(lastLine(r.Stderr))
+		}
+		if r.OK() {
+			switch Outcome(r.Stdout) {
+			case Changed:
+				status, color = changedLabel, ssh.ColorYellow
+			case Unchanged:
+				status, color = Unchanged, ssh.ColorGreen
+			default:
+				status, errMsg = "error", "module reported no status"
+			}
+		}
+		switch color {
+		case ssh.ColorYellow:
+			changed++
+		case ssh.ColorGreen:
+			unchanged++
+		default:
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s%s%s\t%s\t%s\n",
+			r.Host.Name, color, status, ssh.ColorReset, r.Duration.Round(time.Millisecond), errMsg)
+	}
+	w.Flush()
+
+	color, mark := ssh.ColorGreen, "+"
+	if failed > 0 {
+		color, mark = ssh.ColorRed, "!"
+	}
+	fmt.Printf("\n%s[%s] %s finished: %d %s, %d ok, %d failed.%s\n",
+		color, mark, module, changed, changedLabel, unchanged, failed, ssh.ColorReset)
+}
+
+func lastLine(b []byte) string {
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	return lines[len(lines)-1]
+}
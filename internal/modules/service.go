@@ -0,0 +1,100 @@
+package modules
+
+import (
+	"fmt"
+	"regexp"
+)
+
+/* =========================
+   SERVICE
+========================= */
+
+var unitName = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+$`)
+
+func init() {
+	register(Module{
+		Name:    "service",
+		Summary: "start, stop, restart or reload a systemd service and set whether it starts at boot",
+		Params: []Param{
+			{Name: "name", Required: true, Pattern: unitName, Help: "unit name, e.g. nginx or nginx.service"},
+			{Name: "state", Choices: []string{"started", "stopped", "restarted", "reloaded"}},
+			{Name: "enabled", Choices: yesNo, Help: "start at boot"},
+		},
+		script: serviceScript,
+	})
+}
+
+func serviceScript(a Args) (string, error) {
+	if a["state"] == "" && a["enabled"] == "" {
+		return "", fmt.Errorf("set state, enabled or both")
+	}
+	return fmt.Sprintf(`unit=%s
+state=%s
+enabled=%s
+`, q(a["name"]), q(a["state"]), q(a["enabled"])) + `
+command -v systemctl >/dev/null 2>&1 || nr_fail "systemctl not found (the service module needs systemd)"
+[ "$(systemctl show -p LoadState --value "$unit" 2>/dev/null)" = loaded ] || nr_fail "unit $unit not found"
+
+# State before and after, for the diff.
+before=
+after=
+if [ -n "$state" ]; then
+	cur=inactive
+	systemctl is-active -q "$unit" && cur=active
+	want=active
+	case $state in
+	stopped) want=inactive ;;
+	restarted) [ "$cur" = active ] && want="active (restarted)" ;;
+	reloaded) [ "$cur" = active ] && want="active (reloaded)" ;;
+	esac
+	before="state: $cur"
+	after="state: $want"
+fi
+if [ -n "$enabled" ]; then
+	cur=disabled
+	systemctl is-enabled -q "$unit" 2>/dev/null && cur=enabled
+	want=disabled
+	[ "$enabled" = yes ] && want=enabled
+	before="$before${before:+
+}enabled: $cur"
+	after="$after${after:+
+}enabled: $want"
+fi
+nr_diff_text "service $unit" "$before" "$after"
+
+case $state in
+started)
+	if ! systemctl is-active -q "$unit"; then
+		if nr_change "start $unit"; then systemctl start "$unit" || exit 1; fi
+	fi
+	;;
+stopped)
+	if systemctl is-active -q "$unit"; then
+		if nr_change "stop $unit"; then systemctl stop "$unit" || exit 1; fi
+	fi
+	;;
+restarted)
+	if nr_change "restart $unit"; then systemctl restart "$unit" || exit 1; fi
+	;;
+reloaded)
+	if systemctl is-active -q "$unit"; then
+		if nr_change "reload $unit"; then systemctl reload "$unit" || exit 1; fi
+	else
+		if nr_change "start $unit"; then systemctl start "$unit" || exit 1; fi
+	fi
+	;;
+esac
+
+case $enabled in
+yes)
+	if ! systemctl is-enabled -q "$unit" 2>/dev/null; then
+		if nr_change "enable $unit"; then systemctl enable -q "$unit" || exit 1; fi
+	fi
+	;;
+no)
+	if systemctl is-enabled -q "$unit" 2>/dev/null; then
+		if nr_change "disable $unit"; then systemctl disable -q "$unit" || exit 1; fi
+	fi
+	;;
+esac`, nil
+}
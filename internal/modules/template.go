@@ -0,0 +1,128 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+
+	"neurader/internal/inventory"
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   CONFIG TEMPLATES
+========================= */
+
+// TemplateOptions control how a rendered template is installed.
+type TemplateOptions struct {
+	Mode     string
+	Owner    string
+	Group    string
+	Backup   bool   // keep a timestamped copy of the file being replaced
+	Validate string // checks the new file, as the file module's validate does
+	Reload   string // run on the hosts where the file changed
+}
+
+// Template renders the local Go template src once per target, with the
+// host's vars and facts, and installs the result at dest through the
+// file module: hosts whose file already matches are left alone.
+func Template(ctx context.Context, targets []string, src, dest string, to TemplateOptions, mo Options, opts ssh.RunOptions) ([]ssh.Result, error) {
+	text, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	// Syntax errors are the same for every host: report them once.
+	if _, err := template.New(src).Parse(string(text)); err != nil {
+		return nil, err
+	}
+
+	args := Args{"path": dest, "content": "", "mode": to.Mode, "owner": to.Owner, "group": to.Group, "validate": to.Validate, "backup": "no"}
+	if to.Backup {
+		args["backup"] = "yes"
+	}
+	if _, _, err := Script("file", args, mo); err != nil {
+		return nil, err
+	}
+
+	inv := inventory.Load(inventory.Path)
+	hosts, err := inv.Resolve(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts matched %v", targets)
+	}
+
+	cmds := make([]ssh.RenderedCommand, len(hosts))
+	for i, h := range hosts {
+		cmds[i] = ssh.RenderedCommand{Host: h}
+		content, err := ssh.Render(string(text), ssh.TemplateData(inv, h))
+		if err != nil {
+			cmds[i].Err = err
+			continue
+		}
+		hostArgs := make(Args, len(args))
+		for k, v := range args {
+			hostArgs[k] = v
+		}
+		hostArgs["content"] = content
+		cmds[i].Command, cmds[i].Stdin, cmds[i].Err = Script("file", hostArgs, mo)
+	}
+
+	results, err := execute(ctx, "template", cmds, mo.Check, opts)
+	if err != nil || to.Reload == "" || ctx.Err() != nil {
+		return results, err
+	}
+	return reload(ctx, results, to.Reload, mo.Check, opts)
+}
+
+// reload runs cmd on the hosts whose file changed. A failed reload fails
+// the host's result.
+func reload(ctx context.Context, results []ssh.Result, cmd string, check bool, opts ssh.RunOptions) ([]ssh.Result, error) {
+	var changed []int
+	var cmds []ssh.RenderedCommand
+	for i, r := range results {
+		if r.OK() && Outcome(r.Stdout) == Changed {
+			changed = append(changed, i)
+			cmds = append(cmds, ssh.RenderedCommand{Host: r.Host, Command: cmd})
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Println("[~] No file changed, nothing to reload.")
+		return results, nil
+	}
+	if check {
+		fmt.Printf("[~] Would reload %d host(s): %s\n", len(changed), cmd)
+		return results, nil
+	}
+
+	fmt.Printf("\n%s[*] Reloading %d host(s): %s%s\n", ssh.ColorYellow, len(changed), cmd, ssh.ColorReset)
+	// The capture, if any, is of the file changes; keep its manifest.
+	opts.Capture = ssh.Capture{}
+	out, err := ssh.NewOutput(opts.Output)
+	if err != nil {
+		return results, err
+	}
+	reloaded, err := ssh.ExecuteCommands(ctx, out, cmds, opts)
+	if err != nil {
+		return results, err
+	}
+	for j, r := range reloaded {
+		if r.OK() {
+			continue
+		}
+		// The file is in place, so keep that result and say what failed after it.
+		res := &results[changed[j]]
+		res.Stderr = append(res.Stderr, r.Stderr...)
+		res.ExitCode, res.Signal, res.Cancelled, res.Skipped = r.ExitCode, r.Signal, r.Cancelled, r.Skipped
+		why := r.Status()
+		if r.Err != nil {
+			why = r.Err.Error()
+		} else if r.ExitCode > 0 {
+			why = fmt.Sprintf("exit status %d", r.ExitCode)
+		}
+		res.Err = fmt.Errorf("file changed but reload failed: %s", why)
+	}
+	return results, nil
+}
@@ -0,0 +1,132 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* =========================
+   USER & GROUP
+========================= */
+
+func init() {
+	register(Module{
+		Name:    "user",
+		Summary: "make sure a local user account exists with the given settings, or is absent",
+		Params: []Param{
+			{Name: "name", Required: true, Pattern: accountName},
+			{Name: "state", Default: "present", Choices: []string{"present", "absent"}},
+			{Name: "uid", Pattern: numericID},
+			{Name: "shell", Pattern: absPath},
+			{Name: "home", Pattern: absPath},
+			{Name: "groups", Help: "supplementary groups, separated by commas; existing memberships are kept"},
+			{Name: "system", Default: "no", Choices: yesNo, Help: "create as a system account"},
+		},
+		script: userScript,
+	})
+	register(Module{
+		Name:    "group",
+		Summary: "make sure a local group exists, or is absent",
+		Params: []Param{
+			{Name: "name", Required: true, Pattern: accountName},
+			{Name: "state", Default: "present", Choices: []string{"present", "absent"}},
+			{Name: "gid", Pattern: numericID},
+			{Name: "system", Default: "no", Choices: yesNo, Help: "create as a system group"},
+		},
+		script: groupScript,
+	})
+}
+
+func userScript(a Args) (string, error) {
+	var groups []string
+	for _, g := range strings.Split(a["groups"], ",") {
+		g = strings.TrimSpace(g)
+		if g == "" {
+			continue
+		}
+		if !accountName.MatchString(g) {
+			return "", fmt.Errorf("invalid group %q", g)
+		}
+		groups = append(groups, g)
+	}
+	return fmt.Sprintf(`name=%s
+state=%s
+uid=%s
+shell=%s
+home=%s
+groups=%s
+system=%s
+`, q(a["name"]), q(a["state"]), q(a["uid"]), q(a["shell"]), q(a["home"]), q(strings.Join(groups, " ")), q(a["system"])) + `
+entry=$(nr_entry passwd "$name")
+
+if [ "$state" = absent ]; then
+	if [ -n "$entry" ]; then
+		command -v userdel >/dev/null 2>&1 || nr_fail "userdel not found"
+		if nr_change "remove user $name"; then userdel "$name" || exit 1; fi
+	fi
+	nr_done
+fi
+
+command -v useradd >/dev/null 2>&1 || nr_fail "useradd not found"
+if [ -z "$entry" ]; then
+	set --
+	[ -n "$uid" ] && set -- "$@" -u "$uid"
+	[ -n "$shell" ] && set -- "$@" -s "$shell"
+	[ -n "$home" ] && set -- "$@" -d "$home"
+	[ "$system" = yes ] && set -- "$@" -r
+	[ "$system" = yes ] || set -- "$@" -m
+	if nr_change "create user $name"; then useradd "$@" "$name" || exit 1; fi
+else
+	cur_uid=$(echo "$entry" | cut -d: -f3)
+	cur_home=$(echo "$entry" | cut -d: -f6)
+	cur_shell=$(echo "$entry" | cut -d: -f7)
+	if [ -n "$uid" ] && [ "$uid" != "$cur_uid" ]; then
+		if nr_change "set uid of $name to $uid"; then usermod -u "$uid" "$name" || exit 1; fi
+	fi
+	if [ -n "$home" ] && [ "$home" != "$cur_home" ]; then
+		if nr_change "set home of $name to $home"; then usermod -d "$home" "$name" || exit 1; fi
+	fi
+	if [ -n "$shell" ] && [ "$shell" != "$cur_shell" ]; then
+		if nr_change "set shell of $name to $shell"; then usermod -s "$shell" "$name" || exit 1; fi
+	fi
+fi
+
+missing=
+member_of=" $(id -nG "$name" 2>/dev/null) "
+for g in $groups; do
+	case $member_of in
+	*" $g "*) ;;
+	*) missing="$missing${missing:+,}$g" ;;
+	esac
+done
+if [ -n "$missing" ]; then
+	if nr_change "add $name to $missing"; then usermod -a -G "$missing" "$name" || exit 1; fi
+fi`, nil
+}
+
+func groupScript(a Args) (string, error) {
+	return fmt.Sprintf(`name=%s
+state=%s
+gid=%s
+system=%s
+`, q(a["name"]), q(a["state"]), q(a["gid"]), q(a["system"])) + `
+entry=$(nr_entry group "$name")
+
+if [ "$state" = absent ]; then
+	if [ -n "$entry" ]; then
+		command -v groupdel >/dev/null 2>&1 || nr_fail "groupdel not found"
+		if nr_change "remove group $name"; then groupdel "$name" || exit 1; fi
+	fi
+	nr_done
+fi
+
+command -v groupadd >/dev/null 2>&1 || nr_fail "groupadd not found"
+if [ -z "$entry" ]; then
+	set --
+	[ -n "$gid" ] && set -- "$@" -g "$gid"
+	[ "$system" = yes ] && set -- "$@" -r
+	if nr_change "create group $name"; then groupadd "$@" "$name" || exit 1; fi
+elif [ -n "$gid" ] && [ "$gid" != "$(echo "$entry" | cut -d: -f3)" ]; then
+	if nr_change "set gid of $name to $gid"; then groupmod -g "$gid" "$name" || exit 1; fi
+fi`, nil
+}
@@ -0,0 +1,101 @@
+package netutil
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/* ========================================================================
+   ADDRESS HANDLING
+   Every host:port and URL in neurader is built here so IPv4, IPv6
+   (including link-local zones like fe80::1%eth0) and DNS names behave
+   the same. Never concatenate addr+":22" by hand.
+   ======================================================================== */
+
+// Normalize validates an inventory address and returns its canonical form.
+// IP literals are compressed and IPv4-mapped IPv6 addresses are unmapped;
+// surrounding brackets are accepted and stripped. DNS names are returned
+// lower-cased.
+func Normalize(addr string) (string, error) {
+	a := strings.TrimSpace(addr)
+	if strings.HasPrefix(a, "[") && strings.HasSuffix(a, "]") {
+		a = a[1 : len(a)-1]
+	}
+	if a == "" {
+		return "", fmt.Errorf("empty address")
+	}
+	if ip, err := netip.ParseAddr(a); err == nil {
+		return ip.Unmap().String(), nil
+	}
+	if isHostname(a) {
+		return strings.ToLower(a), nil
+	}
+	return "", fmt.Errorf("%q is not a valid IP address or hostname", addr)
+}
+
+// SameAddr reports whether two addresses refer to the same host once
+// normalised, so "fe80:0::1%eth0" matches "[fe80::1%eth0]".
+func SameAddr(a, b string) bool {
+	na, errA := Normalize(a)
+	nb, errB := Normalize(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return na == nb
+}
+
+// HostPort joins an address and port, bracketing IPv6 literals.
+func HostPort(addr string, port int) string {
+	if n, err := Normalize(addr); err == nil {
+		addr = n
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// HTTPURL builds an http:// URL for addr:port with the given path. IPv6
+// zones are percent-encoded as RFC 6874 requires.
+func HTTPURL(addr string, port int, path string, query url.Values) string {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     HostPort(addr, port),
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// RemoteIP extracts the peer address of an HTTP request. Dual-stack
+// listeners report IPv4 peers as ::ffff:a.b.c.d, which is unmapped back to
+// plain IPv4; link-local zones are preserved so the jumpbox can reach back.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if n, err := Normalize(host); err == nil {
+		return n
+	}
+	return host
+}
+
+func isHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(s, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package netutil
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"192.168.1.10", "192.168.1.10"},
+		{" 10.0.0.1 ", "10.0.0.1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"2001:DB8:0:0::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"fe80:0::1%eth0", "fe80::1%eth0"},
+		{"[fe80::1%eth0]", "fe80::1%eth0"},
+		{"Web-01.Example.COM", "web-01.example.com"},
+		{"db_1", "db_1"},
+		{"host.example.com.", "host.example.com."},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.in)
+		if err != nil {
+			t.Errorf("Normalize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	for _, in := range []string{"", "   ", "[]", "-web", "web-", "a..b", "host name", "10.0.0.1:22", "http://x"} {
+		if got, err := Normalize(in); err == nil {
+			t.Errorf("Normalize(%q) = %q, expected an error", in, got)
+		}
+	}
+}
+
+func TestSameAddrAndHostPort(t *testing.T) {
+	if !SameAddr("fe80:0::1%eth0", "[fe80::1%eth0]") {
+		t.Error("SameAddr: equivalent link-local addresses differ")
+	}
+	if SameAddr("fe80::1%eth0", "fe80::1%eth1") {
+		t.Error("SameAddr: different zones match")
+	}
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.1:22"},
+		{"2001:db8::1", "[2001:db8::1]:22"},
+		{"[::1]", "[::1]:22"},
+		{"Web1", "web1:22"},
+	}
+	for _, tt := range tests {
+		if got := HostPort(tt.addr, 22); got != tt.want {
+			t.Errorf("HostPort(%q, 22) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
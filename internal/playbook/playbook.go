@@ -0,0 +1,242 @@
+package playbook
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"neurader/internal/modules"
+	"neurader/internal/ssh"
+)
+
+/* ========================================================================
+   PLAYBOOKS
+   A playbook is a YAML list of plays. Each play targets hosts the same
+   way "run" does and executes its tasks in order through the normal
+   executor: a task finishes on every host before the next one starts,
+   and a host that fails a task is dropped from the rest of the play.
+   Handlers run once at the end of a play on the hosts whose tasks
+   notified them.
+   ======================================================================== */
+
+type Play struct {
+	Name           string                 `yaml:"name"`
+	Targets        []string               `yaml:"targets"`
+	Vars           map[string]interface{} `yaml:"vars"`
+	Become         string                 `yaml:"become"`
+	Sudo           bool                   `yaml:"sudo"`
+	Forks          int                    `yaml:"forks"`
+	Serial         string                 `yaml:"serial"` // batches within each task
+	Timeout        time.Duration          `yaml:"timeout"`
+	MaxFailPercent *int                   `yaml:"max_fail_percent"`
+	Tasks          []Task                 `yaml:"tasks"`
+	Handlers       []Task                 `yaml:"handlers"`
+}
+
+// Task is one step of a play: a shell command or a built-in module.
+// Command, module args, When and Creates are templates rendered per host,
+// with earlier registered results in .vars.
+type Task struct {
+	Name         string     `yaml:"name"`
+	Command      string     `yaml:"command"`
+	Module       string     `yaml:"module"`
+	Args         moduleArgs `yaml:"args"`
+	When         string     `yaml:"when"`    // run only where this evaluates true
+	Creates      string     `yaml:"creates"` // skip where this path already exists
+	IgnoreErrors bool       `yaml:"ignore_errors"`
+	Register     string     `yaml:"register"` // store the result in .vars.<name>
+	Notify       names      `yaml:"notify"`   // handlers to run if the task changed the host
+}
+
+// names accepts either a single string or a list of them.
+type names []string
+
+func (n *names) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*n = names{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*n = list
+	return nil
+}
+
+// moduleArgs keeps every argument as written: YAML would otherwise turn
+// "mode: 0644" into the number 420.
+type moduleArgs map[string]string
+
+func (a *moduleArgs) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: args must be a mapping", value.Line)
+	}
+	args := moduleArgs{}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		k, v := value.Content[i], value.Content[i+1]
+		if v.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d: argument %q must be a single value", v.Line, k.Value)
+		}
+		args[k.Value] = v.Value
+	}
+	*a = args
+	return nil
+}
+
+// Label is how the task is shown in output and the result matrix.
+func (t Task) Label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	text := t.Command
+	if t.Module != "" {
+		keys := make([]string, 0, len(t.Args))
+		for k := range t.Args {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		text = t.Module
+		for _, k := range keys {
+			text += " " + k + "=" + t.Args[k]
+		}
+	}
+	return ssh.Truncate(strings.Join(strings.Fields(text), " "), 40)
+}
+
+// Load reads and validates a playbook file.
+func Load(path string) ([]Play, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plays []Play
+	if err := yaml.Unmarshal(data, &plays); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(plays) == 0 {
+		return nil, fmt.Errorf("%s: no plays", path)
+	}
+	for i, p := range plays {
+		if err := p.Validate(); err != nil {
+			name := p.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("%s: play %s: %v", path, name, err)
+		}
+	}
+	return plays, nil
+}
+
+// registerName must work as a template field: {{ .vars.name.rc }}.
+var registerName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks a play's structure and handler references.
+func (p Play) Validate() error {
+	if len(p.Targets) == 0 {
+		return fmt.Errorf("no targets")
+	}
+	if len(p.Tasks) == 0 {
+		return fmt.Errorf("no tasks")
+	}
+	handlers := map[string]bool{}
+	for _, h := range p.Handlers {
+		if h.Name == "" {
+			return fmt.Errorf("handler without a name")
+		}
+		if handlers[h.Name] {
+			return fmt.Errorf("duplicate handler %q", h.Name)
+		}
+		handlers[h.Name] = true
+	}
+	check := func(kind string, t Task) error {
+		switch {
+		case strings.TrimSpace(t.Command) == "" && t.Module == "":
+			return fmt.Errorf("%s %q: no command or module", kind, t.Label())
+		case t.Command != "" && t.Module != "":
+			return fmt.Errorf("%s %q: set command or module, not both", kind, t.Label())
+		case t.Module == "" && len(t.Args) > 0:
+			return fmt.Errorf("%s %q: args without a module", kind, t.Label())
+		case t.Register != "" && !registerName.MatchString(t.Register):
+			return fmt.Errorf("%s %q: register name %q must be letters, digits and underscores", kind, t.Label(), t.Register)
+		}
+		for _, n := range t.Notify {
+			if !handlers[n] {
+				return fmt.Errorf("%s %q: notifies unknown handler %q", kind, t.Label(), n)
+			}
+		}
+		if t.Module != "" {
+			if _, ok := modules.Lookup(t.Module); !ok {
+				return fmt.Errorf("%s %q: unknown module %q (available: %s)", kind, t.Label(), t.Module, strings.Join(modules.Names(), ", "))
+			}
+			if !t.templatedArgs() {
+				// Fixed arguments can be checked now rather than per host.
+				if _, _, err := modules.Script(t.Module, modules.Args(t.Args), modules.Options{}); err != nil {
+					return fmt.Errorf("%s %q: %v", kind, t.Label(), err)
+				}
+			}
+		}
+		return nil
+	}
+	for _, t := range p.Tasks {
+		if err := check("task", t); err != nil {
+			return err
+		}
+	}
+	for _, h := range p.Handlers {
+		if err := check("handler", h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunOptions applies the play's settings on top of the command line's.
+func (p Play) RunOptions(base ssh.RunOptions) ssh.RunOptions {
+	opts := base
+	if p.Become != "" || p.Sudo {
+		opts.Become = ssh.Become{User: p.Become, Sudo: p.Sudo}
+	}
+	if p.Forks > 0 {
+		opts.Forks = p.Forks
+	}
+	if p.Serial != "" {
+		opts.Serial = p.Serial
+	}
+	if p.Timeout > 0 {
+		opts.Timeout = p.Timeout
+	}
+	if p.MaxFailPercent != nil {
+		opts.MaxFailPercent = *p.MaxFailPercent
+	}
+	return opts
+}
+
+func (t Task) templatedArgs() bool {
+	for _, v := range t.Args {
+		if strings.Contains(v, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+// command renders the task for one host: its command template, or its
+// module's script with the arguments rendered and the script's stdin.
+func (t Task) command(data map[string]interface{}, mode modules.Options) (string, []byte, error) {
+	if t.Module == "" {
+		cmd, err := ssh.Render(t.Command, data)
+		return cmd, nil, err
+	}
+	args, err := modules.RenderArgs(modules.Args(t.Args), data)
+	if err != nil {
+		return "", nil, err
+	}
+	return modules.Script(t.Module, args, mode)
+}
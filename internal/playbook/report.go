@@ -0,0 +1,98 @@
+package playbook
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   RESULT MATRIX
+========================= */
+
+// colorNone is the terminal's default colour. It has the same length as
+// the ssh.Color* codes, so uncoloured cells keep tabwriter columns aligned.
+const colorNone = "\033[39m"
+
+func outcomeColor(status string) string {
+	switch status {
+	case Changed, Ignored:
+		return ssh.ColorYellow
+	case OK:
+		return ssh.ColorGreen
+	case Failed:
+		return ssh.ColorRed
+	}
+	return colorNone
+}
+
+// Print shows one row per task and one column per host, then a recap
+// line per host.
+func (r *Report) Print() {
+	if len(r.Tasks) == 0 {
+		return
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	// Header cells get the same escape sequences as status cells so the
+	// host columns line up.
+	names := make([]string, len(r.Hosts))
+	dashes := make([]string, len(r.Hosts))
+	for i, h := range r.Hosts {
+		names[i] = colorNone + h + ssh.ColorReset
+		dashes[i] = colorNone + strings.Repeat("-", len(h)) + ssh.ColorReset
+	}
+	fmt.Fprintf(w, "PLAY\tTASK\t%s\n", strings.Join(names, "\t"))
+	fmt.Fprintf(w, "----\t----\t%s\n", strings.Join(dashes, "\t"))
+
+	for _, t := range r.Tasks {
+		task := t.Task
+		if t.Handler {
+			task += " (handler)"
+		}
+		cells := make([]string, len(r.Hosts))
+		for i, h := range r.Hosts {
+			status := t.Status[h]
+			if status == "" {
+				status = "-"
+			}
+			label := status
+			if status == Changed && r.Check {
+				label = "would change"
+			}
+			cells[i] = outcomeColor(status) + label + ssh.ColorReset
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Play, task, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for _, h := range r.Hosts {
+		counts := map[string]int{}
+		for _, t := range r.Tasks {
+			counts[t.Status[h]]++
+		}
+		color := ssh.ColorGreen
+		if counts[Failed] > 0 {
+			color = ssh.ColorRed
+		}
+		fmt.Fprintf(w, "%s%s%s\tchanged=%d\tok=%d\tskipped=%d\tignored=%d\tfailed=%d\n",
+			color, h, ssh.ColorReset, counts[Changed], counts[OK], counts[Skipped], counts[Ignored], counts[Failed])
+	}
+	w.Flush()
+
+	verb := "Playbook finished"
+	if r.Check {
+		verb = "Check finished, nothing was changed"
+	}
+	if failed := r.FailedHosts(); len(failed) > 0 {
+		fmt.Printf("\n%s[!] %s: %d of %d host(s) failed (%s).%s\n",
+			ssh.ColorRed, verb, len(failed), len(r.Hosts), strings.Join(failed, ", "), ssh.ColorReset)
+		return
+	}
+	fmt.Printf("\n%s[+] %s: %d host(s) ok.%s\n", ssh.ColorGreen, verb, len(r.Hosts), ssh.ColorReset)
+}
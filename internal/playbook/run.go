@@ -0,0 +1,362 @@
+package playbook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"neurader/internal/inventory"
+	"neurader/internal/modules"
+	"neurader/internal/ssh"
+)
+
+/* =========================
+   PLAY EXECUTION
+========================= */
+
+// Outcomes of a task on one host.
+const (
+	Changed = "changed" // the command ran and succeeded
+	OK      = "ok"      // nothing to do: a module found nothing to change, or the creates path exists
+	Skipped = "skipped" // when evaluated false, or a command in check mode
+	Failed  = "failed"  // the host is dropped from the rest of the play
+	Ignored = "ignored" // failed, but the task has ignore_errors
+)
+
+// TaskResult is one row of the result matrix.
+type TaskResult struct {
+	Play    string
+	Task    string
+	Handler bool
+	Status  map[string]string // host name -> outcome; absent if not attempted
+	Errors  map[string]string // host name -> why it failed
+}
+
+// Report collects every task's results in execution order.
+type Report struct {
+	Hosts []string // every targeted host, in first-seen order
+	Tasks []*TaskResult
+	Check bool // nothing was changed; Changed means it would have been
+	seen  map[string]bool
+}
+
+func (r *Report) addHost(name string) {
+	if r.seen == nil {
+		r.seen = map[string]bool{}
+	}
+	if !r.seen[name] {
+		r.seen[name] = true
+		r.Hosts = append(r.Hosts, name)
+	}
+}
+
+// FailedHosts lists the hosts with at least one failed task.
+func (r *Report) FailedHosts() []string {
+	var failed []string
+	for _, h := range r.Hosts {
+		for _, t := range r.Tasks {
+			if t.Status[h] == Failed {
+				failed = append(failed, h)
+				break
+			}
+		}
+	}
+	return failed
+}
+
+// hostRun is one host's progress through a play.
+type hostRun struct {
+	host     ssh.HostEntry
+	vars     map[string]interface{} // play vars, then registered results
+	notified map[string]bool
+	failed   bool
+}
+
+// data is the template data for the host: what "run" templates see, with
+// the play's vars and registered results layered over .vars.
+func (r *hostRun) data(inv inventory.Inventory) map[string]interface{} {
+	d := ssh.TemplateData(inv, r.host)
+	vars := d["vars"].(map[string]interface{})
+	for k, v := range r.vars {
+		vars[k] = v
+	}
+	return d
+}
+
+// Apply runs plays in order, streaming command output to out, and returns
+// the per-task per-host results. Only cancellation stops it early.
+//
+// In check mode module tasks only report what they would change, and
+// command tasks are skipped: there is no telling what a command would do.
+// Handlers are notified by the changes modules would make.
+func Apply(ctx context.Context, plays []Play, base ssh.RunOptions, mode modules.Options, out ssh.Output) (*Report, error) {
+	report := &Report{Check: mode.Check}
+	for i, p := range plays {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := applyPlay(ctx, p, playLabel(p, i), base, mode, out, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func playLabel(p Play, i int) string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return fmt.Sprintf("play %d", i+1)
+}
+
+func applyPlay(ctx context.Context, p Play, label string, base ssh.RunOptions, mode modules.Options, out ssh.Output, report *Report) error {
+	inv := inventory.Load(inventory.Path)
+	hosts, err := inv.Resolve(p.Targets)
+	if err != nil {
+		return fmt.Errorf("%s: %v", label, err)
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("%s: no hosts matched %v", label, p.Targets)
+	}
+	opts := p.RunOptions(base)
+
+	fmt.Printf("\n%s[*] PLAY %s (%d host(s))%s\n", ssh.ColorGreen, label, len(hosts), ssh.ColorReset)
+
+	runs := make([]*hostRun, len(hosts))
+	for i, h := range hosts {
+		vars := make(map[string]interface{}, len(p.Vars))
+		for k, v := range p.Vars {
+			vars[k] = v
+		}
+		runs[i] = &hostRun{host: h, vars: vars, notified: map[string]bool{}}
+		report.addHost(h.Name)
+	}
+
+	for _, t := range p.Tasks {
+		if ctx.Err() != nil {
+			return nil
+		}
+		report.Tasks = append(report.Tasks, runTask(ctx, inv, label, t, false, runs, opts, mode, out))
+	}
+
+	// Handlers run in the order they are defined, not the order they were
+	// notified, and only on hosts that are still in the play.
+	for _, h := range p.Handlers {
+		var notified []*hostRun
+		for _, r := range runs {
+			if r.notified[h.Name] && !r.failed {
+				notified = append(notified, r)
+			}
+		}
+		if len(notified) == 0 || ctx.Err() != nil {
+			continue
+		}
+		report.Tasks = append(report.Tasks, runTask(ctx, inv, label, h, true, notified, opts, mode, out))
+	}
+	return nil
+}
+
+// runTask runs one task on every host in runs that hasn't failed yet.
+func runTask(ctx context.Context, inv inventory.Inventory, play string, t Task, handler bool, runs []*hostRun, opts ssh.RunOptions, mode modules.Options, out ssh.Output) *TaskResult {
+	tr := &TaskResult{Play: play, Task: t.Label(), Handler: handler, Status: map[string]string{}, Errors: map[string]string{}}
+	kind := "TASK"
+	if handler {
+		kind = "HANDLER"
+	}
+	fmt.Printf("\n%s[*] %s %s%s\n", ssh.ColorYellow, kind, t.Label(), ssh.ColorReset)
+
+	var pending []*hostRun
+	for _, r := range runs {
+		if r.failed {
+			continue
+		}
+		if t.When != "" {
+			ok, err := evalWhen(t.When, r.data(inv))
+			if err != nil {
+				tr.record(r, t, Failed, fmt.Errorf("when: %v", err), nil)
+				continue
+			}
+			if !ok {
+				tr.record(r, t, Skipped, nil, nil)
+				continue
+			}
+		}
+		pending = append(pending, r)
+	}
+	if mode.Check && t.Module == "" && len(pending) > 0 {
+		fmt.Println("[~] Skipped in check mode: commands can't be previewed.")
+		for _, r := range pending {
+			tr.record(r, t, Skipped, nil, nil)
+		}
+		return tr
+	}
+	if t.Creates != "" && len(pending) > 0 {
+		pending = checkCreates(ctx, inv, t, pending, opts, tr)
+	}
+	if len(pending) == 0 {
+		fmt.Println("[~] Nothing to run.")
+		return tr
+	}
+
+	cmds := make([]ssh.RenderedCommand, len(pending))
+	for i, r := range pending {
+		cmd, stdin, err := t.command(r.data(inv), mode)
+		cmds[i] = ssh.RenderedCommand{Host: r.host, Command: cmd, Stdin: stdin, Err: err}
+	}
+	if t.Module != "" {
+		out = modules.FilterOutput(out)
+	}
+	results, err := ssh.ExecuteCommands(ctx, taskOutput{out}, cmds, opts)
+	if err != nil {
+		for _, r := range pending {
+			tr.record(r, t, Failed, err, nil)
+		}
+		return tr
+	}
+	for i, res := range results {
+		res := res
+		switch {
+		case !res.OK():
+			tr.record(pending[i], t, Failed, resultError(res), &res)
+		case t.Module == "":
+			tr.record(pending[i], t, Changed, nil, &res)
+		default:
+			switch modules.Outcome(res.Stdout) {
+			case modules.Changed:
+				tr.record(pending[i], t, Changed, nil, &res)
+			case modules.Unchanged:
+				tr.record(pending[i], t, OK, nil, &res)
+			default:
+				tr.record(pending[i], t, Failed, fmt.Errorf("module reported no status"), &res)
+			}
+		}
+	}
+	return tr
+}
+
+// checkCreates tests each host for the task's creates path and returns
+// the hosts where it is missing, i.e. where the task still has to run.
+func checkCreates(ctx context.Context, inv inventory.Inventory, t Task, runs []*hostRun, opts ssh.RunOptions, tr *TaskResult) []*hostRun {
+	cmds := make([]ssh.RenderedCommand, len(runs))
+	for i, r := range runs {
+		path, err := ssh.Render(t.Creates, r.data(inv))
+		cmds[i] = ssh.RenderedCommand{Host: r.host, Command: "test -e " + ssh.ShellQuote(path), Err: err}
+	}
+	results, err := ssh.ExecuteCommands(ctx, quietOutput{}, cmds, opts)
+	if err != nil {
+		for _, r := range runs {
+			tr.record(r, t, Failed, fmt.Errorf("creates: %v", err), nil)
+		}
+		return nil
+	}
+
+	var missing []*hostRun
+	for i, res := range results {
+		switch {
+		case res.OK():
+			tr.record(runs[i], t, OK, nil, nil)
+		case res.Err == nil && res.Signal == "" && res.ExitCode == 1:
+			missing = append(missing, runs[i])
+		default:
+			tr.record(runs[i], t, Failed, fmt.Errorf("creates: %v", resultError(res)), nil)
+		}
+	}
+	return missing
+}
+
+// record stores a host's outcome and applies its effects on the play:
+// ignore_errors, dropping failed hosts, notifying handlers and register.
+// A run cancelled by the operator is a failure even with ignore_errors.
+func (tr *TaskResult) record(r *hostRun, t Task, status string, err error, res *ssh.Result) {
+	if status == Failed && t.IgnoreErrors && (res == nil || !(res.Cancelled || res.Skipped)) {
+		status = Ignored
+	}
+	name := r.host.Name
+	tr.Status[name] = status
+	if err != nil {
+		tr.Errors[name] = err.Error()
+	}
+
+	switch status {
+	case Failed:
+		r.failed = true
+		// The executor has already reported connection and template errors.
+		if err != nil && (res == nil || res.Err == nil) {
+			fmt.Printf("[%s] %sFailed%s: %v\n", name, ssh.ColorRed, ssh.ColorReset, err)
+		}
+	case Ignored:
+		fmt.Printf("[%s] %sFailed (ignored)%s: %v\n", name, ssh.ColorYellow, ssh.ColorReset, err)
+	case Changed:
+		for _, n := range t.Notify {
+			r.notified[n] = true
+		}
+	}
+
+	if t.Register != "" {
+		reg := map[string]interface{}{
+			"stdout":  "",
+			"stderr":  "",
+			"rc":      -1,
+			"changed": status == Changed,
+			"failed":  status == Failed || status == Ignored,
+			"skipped": status == Skipped,
+		}
+		if res != nil {
+			reg["stdout"] = strings.TrimRight(string(modules.StripStatus(res.Stdout)), "\n")
+			reg["stderr"] = strings.TrimRight(string(res.Stderr), "\n")
+			reg["rc"] = res.ExitCode
+		}
+		r.vars[t.Register] = reg
+	}
+}
+
+// resultError explains why a command result is not OK.
+func resultError(res ssh.Result) error {
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.Signal != "" {
+		return fmt.Errorf("killed by signal %s", res.Signal)
+	}
+	return fmt.Errorf("exited with status %d", res.ExitCode)
+}
+
+/* =========================
+   TEMPLATES
+========================= */
+
+// evalWhen renders a condition and interprets the result. A bare
+// expression such as `eq .vars.env "prod"` is wrapped in {{ }} for you.
+func evalWhen(expr string, data map[string]interface{}) (bool, error) {
+	if !strings.Contains(expr, "{{") {
+		expr = "{{ " + expr + " }}"
+	}
+	s, err := ssh.Render(expr, data)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "false", "0", "no":
+		return false, nil
+	}
+	return true, nil
+}
+
+/* =========================
+   OUTPUT ADAPTERS
+========================= */
+
+// taskOutput streams a task through the run's output mode but leaves the
+// summary to the playbook's result matrix.
+type taskOutput struct{ ssh.Output }
+
+func (taskOutput) Close(results []ssh.Result) {}
+
+// quietOutput discards everything, for the creates probes.
+type quietOutput struct{}
+
+func (quietOutput) Info(format string, args ...interface{})      {}
+func (quietOutput) Start(host ssh.HostEntry)                     {}
+func (quietOutput) Line(host ssh.HostEntry, stream, line string) {}
+func (quietOutput) Finish(res ssh.Result)                        {}
+func (quietOutput) Close(results []ssh.Result)                   {}
@@ -0,0 +1,141 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"* * * foo *",
+		"* * * * sat-sun",
+		"@every",
+	}
+	for _, expr := range tests {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"0,15 11 * * *", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * mar *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * FRI", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		// 7 is Sunday, like 0.
+		{"0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 6-7", time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches (Vixie cron).
+		{"0 0 15 * fri", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 2 * sun", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		// One day field is *: only the other one restricts.
+		{"0 0 15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		// A field starting with * counts as unrestricted for the OR rule,
+		// steps included, so this needs a Friday on the 1st, 11th, 21st
+		// or 31st.
+		{"0 0 */10 * fri", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Never matches.
+		{"0 0 31 2 *", time.Time{}},
+		{"0 0 30 feb *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextIsStrictlyAfter(t *testing.T) {
+	c, err := ParseCron("30 10 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	if got, want := c.Next(at), at.AddDate(0, 0, 1); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", at, got, want)
+	}
+	if got := c.Next(at.Add(-time.Second)); !got.Equal(at) {
+		t.Errorf("Next(%v) = %v, want %v", at.Add(-time.Second), got, at)
+	}
+}
+
+func TestCronMinGap(t *testing.T) {
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"* * * * *", time.Minute},
+		{"*/15 * * * *", 15 * time.Minute},
+		{"0,50 * * * *", 10 * time.Minute},
+		{"0 */6 * * *", 6 * time.Hour},
+		{"0 3 * * *", 24 * time.Hour},
+		{"0 3 * * mon,tue", 24 * time.Hour},
+		{"0 0 1 * *", 28 * 24 * time.Hour}, // February 2025
+		{"0 0 29 2 *", 1461 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.MinGap(from); got != tt.want {
+			t.Errorf("MinGap(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestValidateJitter(t *testing.T) {
+	tests := []struct {
+		cron   string
+		jitter time.Duration
+		ok     bool
+	}{
+		{"*/15 * * * *", 0, true},
+		{"*/15 * * * *", 14 * time.Minute, true},
+		{"*/15 * * * *", 15 * time.Minute, false},
+		{"*/15 * * * *", time.Hour, false},
+		{"0,50 * * * *", 10 * time.Minute, false},
+		{"0 3 * * *", 2 * time.Hour, true},
+		{"* * * * *", time.Minute, false},
+	}
+	for _, tt := range tests {
+		d := Definition{Name: "x", Cron: tt.cron, Targets: []string{"web"}, Command: "true", Jitter: tt.jitter}
+		if _, err := d.Validate(); (err == nil) != tt.ok {
+			t.Errorf("cron %q with jitter %v: Validate = %v", tt.cron, tt.jitter, err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"neurader/internal/control"
+	"neurader/internal/jobs"
+)
+
+/* =========================
+   SCHEDULER
+========================= */
+
+const (
+	opList  = "schedule.list"
+	opRun   = "schedule.run"
+	opPause = "schedule.pause"
+)
+
+type entry struct {
+	def  Definition
+	cron Cron
+	err  error     // invalid definition; never runs
+	slot time.Time // next scheduled time
+	next time.Time // slot plus jitter: when it actually fires
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	state   map[string]*entryState
+	modTime time.Time
+	loadErr error
+}
+
+// Serve loads the schedules, registers the schedule operations on the
+// control socket and runs the scheduler. Edits to the schedule file are
+// picked up without a restart. It never returns.
+func Serve() {
+	s := &scheduler{entries: map[string]*entry{}, state: loadState()}
+	s.reload(true)
+
+	control.Handle(opList, s.handleList)
+	control.Handle(opRun, s.handleRun)
+	control.Handle(opPause, s.handlePause)
+
+	for now := range time.Tick(time.Second) {
+		s.tick(now)
+	}
+}
+
+// reload re-reads the schedule file if it changed. At startup it also
+// applies each schedule's missed-run policy.
+func (s *scheduler) reload(startup bool) {
+	info, err := os.Stat(Path)
+	var mod time.Time
+	if err == nil {
+		mod = info.ModTime()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !startup && mod.Equal(s.modTime) {
+		return
+	}
+	s.modTime = mod
+
+	defs, err := Load(Path)
+	s.loadErr = err
+	if err != nil {
+		fmt.Printf("[!] Schedules not reloaded: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	entries := map[string]*entry{}
+	for _, d := range defs {
+		if _, dup := entries[d.Name]; dup {
+			fmt.Printf("[!] Schedule %q is defined twice; ignoring the second one\n", d.Name)
+			continue
+		}
+		e := &entry{def: d}
+		e.cron, e.err = d.Validate()
+		if e.err != nil {
+			fmt.Printf("[!] Schedule %q is invalid: %v\n", d.Name, e.err)
+			entries[d.Name] = e
+			continue
+		}
+		st := s.state[d.Name]
+		if st == nil {
+			st = &entryState{Since: now}
+			s.state[d.Name] = st
+		}
+		// An unchanged schedule keeps its planned run: re-planning from now
+		// would drop a slot that is due but still waiting out its jitter.
+		if old := s.entries[d.Name]; old != nil && old.err == nil && reflect.DeepEqual(old.def, d) {
+			e.slot, e.next = old.slot, old.next
+		} else {
+			s.plan(e, now)
+		}
+		entries[d.Name] = e
+
+		if startup {
+			s.applyMissed(e, st, now)
+		}
+	}
+	s.entries = entries
+	_ = saveState(s.state)
+	if !startup {
+		fmt.Printf("[*] Reloaded %d schedule(s) from %s\n", len(entries), Path)
+	}
+}
+
+// applyMissed handles a scheduled time that passed while the daemon was
+// down, according to the schedule's policy.
+func (s *scheduler) applyMissed(e *entry, st *entryState, now time.Time) {
+	from := st.LastRun
+	if from.Before(st.Since) {
+		from = st.Since
+	}
+	missed := e.cron.Next(from)
+	if missed.IsZero() || !missed.Before(now.Truncate(time.Minute)) {
+		return
+	}
+	if e.def.Missed == MissedRunOnce && !st.Paused {
+		fmt.Printf("[*] Schedule %s missed its run at %s; running once now\n", e.def.Name, missed.Format("2006-01-02 15:04"))
+		e.slot, e.next = missed, now
+		return
+	}
+	fmt.Printf("[~] Schedule %s missed its run at %s; waiting for %s\n", e.def.Name,
+		missed.Format("2006-01-02 15:04"), e.slot.Format("2006-01-02 15:04"))
+}
+
+// plan sets the next run after now, with jitter.
+func (s *scheduler) plan(e *entry, now time.Time) {
+	e.slot = e.cron.Next(now)
+	e.next = e.slot
+	if e.def.Jitter > 0 && !e.slot.IsZero() {
+		e.next = e.slot.Add(time.Duration(rand.Int63n(int64(e.def.Jitter))))
+	}
+}
+
+func (s *scheduler) tick(now time.Time) {
+	s.reload(false)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.err != nil || e.next.IsZero() || now.Before(e.next) {
+			continue
+		}
+		slot := e.slot
+		s.plan(e, now)
+		if s.state[e.def.Name].Paused {
+			continue
+		}
+		if _, err := s.fire(e, slot); err != nil {
+			fmt.Printf("[!] Schedule %s: %v\n", e.def.Name, err)
+		}
+	}
+}
+
+// fire starts a run of e as a job, honouring the overlap policy. Callers
+// hold s.mu.
+func (s *scheduler) fire(e *entry, slot time.Time) (string, error) {
+	st := s.state[e.def.Name]
+	if e.def.Overlap != OverlapAllow && st.LastJob != "" && jobs.Running(st.LastJob) {
+		return "", fmt.Errorf("previous run (job %s) is still running; skipped", st.LastJob)
+	}
+
+	reply, err := jobs.Start(jobs.SubmitRequest{
+		Targets:  e.def.Targets,
+		Command:  e.def.Command,
+		Options:  e.def.RunOptions(),
+		Operator: "schedule:" + e.def.Name,
+	})
+	if err != nil {
+		return "", err
+	}
+	st.LastRun, st.LastJob = slot, reply.ID
+	_ = saveState(s.state)
+	return reply.ID, nil
+}
+
+/* =========================
+   CONTROL OPERATIONS
+========================= */
+
+// Status describes one schedule for "schedule list".
+type Status struct {
+	Name     string    `json:"name"`
+	Cron     string    `json:"cron"`
+	Targets  []string  `json:"targets"`
+	Command  string    `json:"command"`
+	Paused   bool      `json:"paused"`
+	Running  bool      `json:"running"`
+	Next     time.Time `json:"next,omitempty"`
+	LastRun  time.Time `json:"last_run,omitempty"`
+	LastJob  string    `json:"last_job,omitempty"`
+	LastDone string    `json:"last_state,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type nameRequest struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+func (s *scheduler) handleList(conn *control.Conn, body json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loadErr != nil {
+		control.Reply(conn, nil, s.loadErr)
+		return
+	}
+	list := []Status{}
+	for _, e := range s.entries {
+		st := Status{Name: e.def.Name, Cron: e.def.Cron, Targets: e.def.Targets, Command: e.def.Command, Next: e.next}
+		if e.err != nil {
+			st.Error = e.err.Error()
+		}
+		if rec := s.state[e.def.Name]; rec != nil {
+			st.Paused, st.LastRun, st.LastJob = rec.Paused, rec.LastRun, rec.LastJob
+			st.Running = rec.LastJob != "" && jobs.Running(rec.LastJob)
+			if j, err := jobs.Find(rec.LastJob); rec.LastJob != "" && err == nil {
+				st.LastDone = j.State
+			}
+		}
+		list = append(list, st)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	control.Reply(conn, list, nil)
+}
+
+func (s *scheduler) handleRun(conn *control.Conn, body json.RawMessage) {
+	var req nameRequest
+	_ = json.Unmarshal(body, &req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[req.Name]
+	switch {
+	case !ok:
+		control.Reply(conn, nil, fmt.Errorf("no schedule named %q", req.Name))
+	case e.err != nil:
+		control.Reply(conn, nil, fmt.Errorf("schedule %q is invalid: %v", req.Name, e.err))
+	default:
+		id, err := s.fire(e, time.Now())
+		control.Reply(conn, id, err)
+	}
+}
+
+func (s *scheduler) handlePause(conn *control.Conn, body json.RawMessage) {
+	var req nameRequest
+	_ = json.Unmarshal(body, &req)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[req.Name]; !ok {
+		control.Reply(conn, nil, fmt.Errorf("no schedule named %q", req.Name))
+		return
+	}
+	// Invalid schedules have no state yet; pausing one still sticks, so
+	// it stays paused once the definition is fixed.
+	st := s.state[req.Name]
+	if st == nil {
+		st = &entryState{Since: time.Now()}
+		s.state[req.Name] = st
+	}
+	st.Paused = req.Paused
+	control.Reply(conn, struct{}{}, saveState(s.state))
+}
+
+// List fetches every schedule's status from the daemon.
+func List() ([]Status, error) {
+	var list []Status
+	err := control.Call(opList, struct{}{}, &list)
+	return list, err
+}
+
+// RunNow starts a schedule immediately and returns the job ID.
+func RunNow(name string) (string, error) {
+	var id string
+	err := control.Call(opRun, nameRequest{Name: name}, &id)
+	return id, err
+}
+
+// SetPaused pauses or resumes a schedule; the flag survives restarts.
+func SetPaused(name string, paused bool) error {
+	return control.Call(opPause, nameRequest{Name: name, Paused: paused}, nil)
+}
@@ -0,0 +1,149 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"neurader/internal/ssh"
+)
+
+/* ========================================================================
+   SCHEDULED COMMANDS
+   The daemon runs fleet commands on cron schedules defined in
+   schedules.yml. Each run is an ordinary async job, so its output and
+   results are available through "neurader jobs". What the scheduler
+   remembers between restarts (last run, pause flag) lives in StatePath.
+   ======================================================================== */
+
+const (
+	Path      = "/etc/neurader/schedules.yml"
+	StatePath = "/var/lib/neurader/schedules.json"
+)
+
+// Overlap policies.
+const (
+	OverlapSkip  = "skip"  // don't start a run while the previous one is still going
+	OverlapAllow = "allow" // always start
+)
+
+// Missed-run policies, applied when the daemon starts after a scheduled
+// time passed while it was down.
+const (
+	MissedSkip    = "skip"     // wait for the next scheduled time
+	MissedRunOnce = "run-once" // run once immediately, however many were missed
+)
+
+type Definition struct {
+	Name           string        `yaml:"name"`
+	Cron           string        `yaml:"cron"`
+	Targets        []string      `yaml:"targets"`
+	Command        string        `yaml:"command"`
+	Jitter         time.Duration `yaml:"jitter"`  // random delay added to every run
+	Overlap        string        `yaml:"overlap"` // skip (default) or allow
+	Missed         string        `yaml:"missed"`  // skip (default) or run-once
+	Timeout        time.Duration `yaml:"timeout"`
+	Serial         string        `yaml:"serial"`
+	Forks          int           `yaml:"forks"`
+	MaxFailPercent *int          `yaml:"max_fail_percent"`
+	Become         string        `yaml:"become"`
+	Sudo           bool          `yaml:"sudo"`
+}
+
+type File struct {
+	Schedules []Definition `yaml:"schedules"`
+}
+
+// Load reads the schedule file; a missing file means no schedules.
+func Load(path string) ([]Definition, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return f.Schedules, nil
+}
+
+// Validate checks a definition and returns its parsed cron expression.
+func (d Definition) Validate() (Cron, error) {
+	switch {
+	case d.Name == "":
+		return Cron{}, fmt.Errorf("schedule without a name")
+	case len(d.Targets) == 0:
+		return Cron{}, fmt.Errorf("no targets")
+	case d.Command == "":
+		return Cron{}, fmt.Errorf("no command")
+	case d.Overlap != "" && d.Overlap != OverlapSkip && d.Overlap != OverlapAllow:
+		return Cron{}, fmt.Errorf("overlap must be %s or %s", OverlapSkip, OverlapAllow)
+	case d.Missed != "" && d.Missed != MissedSkip && d.Missed != MissedRunOnce:
+		return Cron{}, fmt.Errorf("missed must be %s or %s", MissedSkip, MissedRunOnce)
+	}
+	c, err := ParseCron(d.Cron)
+	if err != nil {
+		return c, err
+	}
+	now := time.Now()
+	if c.Next(now).IsZero() {
+		return c, fmt.Errorf("cron expression %q never matches", d.Cron)
+	}
+	// The next run is planned from when the last one fired, so jitter as
+	// long as the gap between runs would skip whole runs.
+	if gap := c.MinGap(now); gap > 0 && d.Jitter >= gap {
+		return c, fmt.Errorf("jitter %v must be under the shortest interval of %q (%v)", d.Jitter, d.Cron, gap)
+	}
+	return c, nil
+}
+
+// RunOptions maps the definition onto the options of a normal run.
+func (d Definition) RunOptions() ssh.RunOptions {
+	opts := ssh.DefaultRunOptions()
+	opts.Timeout = d.Timeout
+	opts.Serial = d.Serial
+	opts.Forks = d.Forks
+	if d.MaxFailPercent != nil {
+		opts.MaxFailPercent = *d.MaxFailPercent
+	}
+	opts.Become = ssh.Become{User: d.Become, Sudo: d.Sudo}
+	return opts
+}
+
+// entryState is what the scheduler persists per schedule.
+type entryState struct {
+	Since   time.Time `json:"since"`    // when the scheduler first saw it
+	LastRun time.Time `json:"last_run"` // when the last run was due (or started, for run-now)
+	LastJob string    `json:"last_job,omitempty"`
+	Paused  bool      `json:"paused,omitempty"`
+}
+
+func loadState() map[string]*entryState {
+	st := map[string]*entryState{}
+	if data, err := os.ReadFile(StatePath); err == nil {
+		_ = json.Unmarshal(data, &st)
+	}
+	return st
+}
+
+func saveState(st map[string]*entryState) error {
+	if err := os.MkdirAll(filepath.Dir(StatePath), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, StatePath)
+}
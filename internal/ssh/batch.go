@@ -0,0 +1,147 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   ROLLING BATCHES
+========================= */
+
+// RunOptions controls how a multi-host run is dispatched.
+type RunOptions struct {
+	Templated      bool          // render the command as a Go template per host
+	Forks          int           // max hosts in flight at once; 0 means unlimited
+	Serial         string        // batch size, either a count ("5") or a percentage ("10%")
+	Pause          time.Duration // wait between batches
+	MaxFailPercent int           // abort remaining batches once a batch exceeds this failure rate
+	Timeout        time.Duration // per-host command timeout; 0 means none
+	Output         string        // stream, grouped, json or summary
+	Become         Become        // run commands as another user via sudo
+	Retry          RetryPolicy   // connection retries per host
+	Breaker        Breaker       // skip hosts that keep failing to connect
+	Force          bool          // ignore the breaker
+	Capture        Capture       // also save raw per-host output to files
+}
+
+// DefaultRunOptions mirrors the historical behaviour: templating on,
+// everything in parallel, never abort. Connections are retried and
+// persistently failing hosts are skipped.
+func DefaultRunOptions() RunOptions {
+	return RunOptions{Templated: true, MaxFailPercent: 100, Retry: DefaultRetryPolicy(), Breaker: DefaultBreaker()}
+}
+
+// batchSize resolves Serial against the number of hosts.
+func batchSize(serial string, total int) (int, error) {
+	serial = strings.TrimSpace(serial)
+	if serial == "" || total == 0 {
+		return total, nil
+	}
+	if strings.HasSuffix(serial, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(serial, "%"), 64)
+		if err != nil || pct <= 0 || pct > 100 {
+			return 0, fmt.Errorf("invalid --serial percentage %q", serial)
+		}
+		return int(math.Max(1, math.Ceil(float64(total)*pct/100))), nil
+	}
+	n, err := strconv.Atoi(serial)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid --serial value %q", serial)
+	}
+	if n > total {
+		n = total
+	}
+	return n, nil
+}
+
+// runBatches executes fn for every index in [0, total) in sequential
+// batches, at most opts.Forks at a time. Once a batch's failure rate
+// exceeds opts.MaxFailPercent, or ctx is cancelled, the remaining hosts
+// are handed to skip instead.
+func runBatches(ctx context.Context, out Output, total int, opts RunOptions, fn func(i int) Result, skip func(i int, reason error) Result) ([]Result, error) {
+	size, err := batchSize(opts.Serial, total)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, total)
+
+	forks := opts.Forks
+	if forks <= 0 {
+		forks = total
+	}
+	sem := make(chan struct{}, forks)
+
+	skipFrom := func(from int, reason error) {
+		for i := from; i < total; i++ {
+			if results[i].Host.Name == "" {
+				results[i] = skip(i, reason)
+			}
+		}
+	}
+
+	for start := 0; start < total; start += size {
+		end := start + size
+		if end > total {
+			end = total
+		}
+		if start > 0 && opts.Pause > 0 {
+			out.Info("[*] Pausing %s before next batch...", opts.Pause)
+			select {
+			case <-time.After(opts.Pause):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			skipFrom(start, fmt.Errorf("skipped: run cancelled"))
+			break
+		}
+		if size < total {
+			out.Info("%s[*] Batch %d-%d of %d%s", ColorYellow, start+1, end, total, ColorReset)
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				// Don't start new hosts once cancelled; the ones in flight
+				// are being signalled by executeOnHost.
+				break
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = fn(i)
+			}(i)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			skipFrom(start, fmt.Errorf("skipped: run cancelled"))
+			break
+		}
+
+		failed := 0
+		for i := start; i < end; i++ {
+			if !results[i].OK() {
+				failed++
+			}
+		}
+		pct := failed * 100 / (end - start)
+		if failed > 0 && pct > opts.MaxFailPercent && end < total {
+			out.Info("%s[!] %d%% of batch failed (max %d%%). Aborting remaining %d host(s).%s",
+				ColorRed, pct, opts.MaxFailPercent, total-end, ColorReset)
+			skipFrom(end, fmt.Errorf("skipped: failure threshold exceeded"))
+			break
+		}
+	}
+	return results, nil
+}
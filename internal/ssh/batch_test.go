@@ -0,0 +1,42 @@
+package ssh
+
+import "testing"
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		serial string
+		total  int
+		want   int
+	}{
+		{"", 10, 10},
+		{"  ", 10, 10},
+		{"1", 10, 1},
+		{"3", 10, 3},
+		{"30", 10, 10},
+		{"25%", 10, 3},
+		{"50%", 10, 5},
+		{"100%", 10, 10},
+		{"1%", 10, 1},
+		{"0.5%", 3, 1},
+		{" 2 ", 5, 2},
+		{"5", 0, 0},
+	}
+	for _, tt := range tests {
+		got, err := batchSize(tt.serial, tt.total)
+		if err != nil {
+			t.Errorf("batchSize(%q, %d): %v", tt.serial, tt.total, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("batchSize(%q, %d) = %d, want %d", tt.serial, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestBatchSizeInvalid(t *testing.T) {
+	for _, serial := range []string{"0", "-1", "x", "0%", "101%", "-5%", "%", "1.5"} {
+		if got, err := batchSize(serial, 10); err == nil {
+			t.Errorf("batchSize(%q, 10) = %d, expected an error", serial, got)
+		}
+	}
+}
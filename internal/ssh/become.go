@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/* =========================
+   PRIVILEGE ESCALATION
+========================= */
+
+// ErrSudoDenied marks a host where sudo refused to run the command, as
+// opposed to the command itself failing.
+var ErrSudoDenied = errors.New("sudo not permitted")
+
+// Become describes running remote commands as another user through sudo.
+type Become struct {
+	User string // target user; empty means root
+	Sudo bool   // escalate even when User is empty
+}
+
+func (b Become) Enabled() bool {
+	return b.Sudo || b.User != ""
+}
+
+func (b Become) user() string {
+	if b.User == "" {
+		return "root"
+	}
+	return b.User
+}
+
+// Wrap returns command as it must be sent to run under b. sudo runs
+// non-interactively (-n) so a missing NOPASSWD rule fails fast instead of
+// hanging on a password prompt. The command gets the target user's login
+// environment: HOME from -H, profile from "sh -l" and its home directory
+// as cwd. /bin/sh is used explicitly because service accounts such as
+// www-data usually have nologin as their shell.
+func (b Become) Wrap(command string) string {
+	return b.wrap(command, "-lc")
+}
+
+// wrapPlain is Wrap without the login profile, for transfer helpers whose
+// stdout is file data: anything a profile prints would end up in it.
+// HOME and cwd are still the target user's.
+func (b Become) wrapPlain(command string) string {
+	return b.wrap(command, "-c")
+}
+
+func (b Become) wrap(command, shellFlags string) string {
+	if !b.Enabled() {
+		return command
+	}
+	inner := "cd ~ 2>/dev/null || cd /\n" + command
+	return fmt.Sprintf("sudo -n -H -u %s -- /bin/sh %s %s", ShellQuote(b.user()), shellFlags, ShellQuote(inner))
+}
+
+// becomeError recognises sudo's own refusals in the command's stderr and
+// explains them. It returns nil when the failure came from the command.
+func becomeError(b Become, code int, stderr []byte) error {
+	if !b.Enabled() || code == 0 {
+		return nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(stderr))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case code == 127 && strings.HasSuffix(line, "sudo: not found"),
+			code == 127 && strings.HasSuffix(line, "sudo: command not found"):
+			return fmt.Errorf("%w: sudo is not installed", ErrSudoDenied)
+		case !strings.HasPrefix(line, "sudo:"):
+			continue
+		case strings.Contains(line, "a password is required"):
+			return fmt.Errorf("%w: a password is required (no NOPASSWD rule)", ErrSudoDenied)
+		case strings.Contains(line, "unknown user"):
+			return fmt.Errorf("%w: user %s does not exist", ErrSudoDenied, b.user())
+		case strings.Contains(line, "sudoers"),
+			strings.Contains(line, "is not allowed to"),
+			strings.Contains(line, "may not run sudo"):
+			return fmt.Errorf("%w: %s", ErrSudoDenied, strings.TrimSpace(strings.TrimPrefix(line, "sudo:")))
+		}
+	}
+	return nil
+}
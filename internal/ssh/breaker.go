@@ -0,0 +1,50 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"neurader/internal/inventory"
+)
+
+/* =========================
+   CIRCUIT BREAKER
+========================= */
+
+// ErrCircuitOpen marks a host skipped because it kept failing to connect.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Breaker skips hosts that failed to connect Threshold times within the
+// last Window, so a dead host doesn't cost every run its full connect
+// timeout and retries. Any successful contact closes the circuit again.
+type Breaker struct {
+	Threshold int // 0 disables the breaker
+	Window    time.Duration
+}
+
+func DefaultBreaker() Breaker {
+	return Breaker{Threshold: 3, Window: 10 * time.Minute}
+}
+
+// check returns ErrCircuitOpen (wrapped with the details) if h should be
+// skipped according to st.
+func (b Breaker) check(st inventory.State, h HostEntry) error {
+	if b.Threshold <= 0 {
+		return nil
+	}
+	rec := st.Hosts[inventory.StateKey(h)]
+	if n := rec.FailuresSince(time.Now().Add(-b.Window)); n >= b.Threshold {
+		return fmt.Errorf("%w: %d connection failures in the last %s, last: %s (use --force to try anyway)",
+			ErrCircuitOpen, n, b.Window, rec.LastError)
+	}
+	return nil
+}
+
+// circuitOpen reports why h must be skipped in this run, or nil.
+func (opts RunOptions) circuitOpen(st inventory.State, h HostEntry) error {
+	if opts.Force {
+		return nil
+	}
+	return opts.Breaker.check(st, h)
+}
@@ -0,0 +1,189 @@
+package ssh
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+/* =========================
+   OUTPUT CAPTURE
+========================= */
+
+// Capture saves each host's stdout and stderr to files exactly as
+// received, alongside manifest.json with every host's result. Terminal
+// output is read line by line as text, so binary data and lines over 64KB
+// only survive in the capture.
+type Capture struct {
+	Dir      string // empty disables capture
+	MaxBytes int64  // per stream; anything beyond is dropped, 0 = unlimited
+	Compress bool   // gzip the files
+}
+
+const ManifestName = "manifest.json"
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._:@-]`)
+
+// CapturedFile describes one saved stream.
+type CapturedFile struct {
+	File      string `json:"file"`      // relative to the capture directory
+	Bytes     int64  `json:"bytes"`     // saved, before compression
+	Received  int64  `json:"received"`  // produced by the command
+	Truncated bool   `json:"truncated"` // Received went over MaxBytes
+	Error     string `json:"error,omitempty"`
+}
+
+type manifestHost struct {
+	Host       string        `json:"host"`
+	Address    string        `json:"address"`
+	Command    string        `json:"command"`
+	Status     string        `json:"status"`
+	OK         bool          `json:"ok"`
+	ExitCode   *int          `json:"exit_code,omitempty"`
+	Signal     string        `json:"signal,omitempty"`
+	DurationMS int64         `json:"duration_ms"`
+	Error      string        `json:"error,omitempty"`
+	Stdout     *CapturedFile `json:"stdout,omitempty"`
+	Stderr     *CapturedFile `json:"stderr,omitempty"`
+}
+
+type manifest struct {
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Hosts    []manifestHost `json:"hosts"`
+}
+
+// captureFile is one stream being saved. Write never fails, so a full
+// disk or the size cap can't interrupt the command or the terminal
+// output it is teed with; problems are reported in the manifest instead.
+type captureFile struct {
+	info CapturedFile
+	max  int64
+	f    *os.File
+	gz   *gzip.Writer
+	w    io.Writer
+}
+
+// Files are named after the host, prefixed with its index in the results:
+// names alone can collide, as two targets can share a name or differ only
+// in characters that aren't safe in a file name.
+func openCaptureFile(c Capture, i int, host HostEntry, stream string) *captureFile {
+	name := fmt.Sprintf("%03d-%s.%s", i+1, unsafeFileChars.ReplaceAllString(host.Name, "_"), stream)
+	if c.Compress {
+		name += ".gz"
+	}
+	cf := &captureFile{info: CapturedFile{File: name}, max: c.MaxBytes}
+	f, err := os.OpenFile(filepath.Join(c.Dir, name), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		cf.info.Error = err.Error()
+		return cf
+	}
+	cf.f, cf.w = f, f
+	if c.Compress {
+		cf.gz = gzip.NewWriter(f)
+		cf.w = cf.gz
+	}
+	return cf
+}
+
+func (cf *captureFile) Write(p []byte) (int, error) {
+	n := len(p)
+	cf.info.Received += int64(n)
+	if cf.w == nil {
+		return n, nil
+	}
+	if cf.max > 0 && cf.info.Bytes+int64(len(p)) > cf.max {
+		p = p[:cf.max-cf.info.Bytes]
+		cf.info.Truncated = true
+	}
+	if len(p) > 0 {
+		written, err := cf.w.Write(p)
+		cf.info.Bytes += int64(written)
+		if err != nil {
+			cf.info.Error = err.Error()
+			cf.w = nil
+		}
+	}
+	return n, nil
+}
+
+func (cf *captureFile) close() {
+	if cf.gz != nil {
+		if err := cf.gz.Close(); err != nil && cf.info.Error == "" {
+			cf.info.Error = err.Error()
+		}
+	}
+	if cf.f != nil {
+		if err := cf.f.Close(); err != nil && cf.info.Error == "" {
+			cf.info.Error = err.Error()
+		}
+	}
+}
+
+// hostCapture holds a host's two streams.
+type hostCapture struct {
+	stdout, stderr *captureFile
+}
+
+func (c Capture) open(i int, host HostEntry) *hostCapture {
+	return &hostCapture{stdout: openCaptureFile(c, i, host, "stdout"), stderr: openCaptureFile(c, i, host, "stderr")}
+}
+
+func (hc *hostCapture) close() {
+	hc.stdout.close()
+	hc.stderr.close()
+}
+
+// writers tees a host's streams into its capture, if there is one.
+func (hc *hostCapture) writers(stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if hc == nil {
+		return stdout, stderr
+	}
+	return io.MultiWriter(stdout, hc.stdout), io.MultiWriter(stderr, hc.stderr)
+}
+
+// writeManifest records results and their capture files, which are
+// indexed like results; a nil capture means the host never ran.
+func (c Capture) writeManifest(started time.Time, results []Result, captures []*hostCapture) error {
+	m := manifest{Started: started, Finished: time.Now(), Hosts: make([]manifestHost, len(results))}
+	for i, r := range results {
+		h := manifestHost{
+			Host:       r.Host.Name,
+			Address:    r.Host.IP,
+			Command:    r.Command,
+			Status:     r.Status(),
+			OK:         r.OK(),
+			Signal:     r.Signal,
+			DurationMS: r.Duration.Milliseconds(),
+		}
+		if r.ExitCode >= 0 {
+			code := r.ExitCode
+			h.ExitCode = &code
+		}
+		if r.Err != nil {
+			h.Error = r.Err.Error()
+		}
+		if hc := captures[i]; hc != nil {
+			h.Stdout, h.Stderr = &hc.stdout.info, &hc.stderr.info
+		}
+		m.Hosts[i] = h
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.Dir, ManifestName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("manifest: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptureFileTruncation(t *testing.T) {
+	tests := []struct {
+		name      string
+		max       int64
+		writes    []string
+		want      string
+		truncated bool
+	}{
+		{"unlimited", 0, []string{"hello ", "world"}, "hello world", false},
+		{"under the cap", 20, []string{"hello ", "world"}, "hello world", false},
+		{"exactly the cap", 11, []string{"hello ", "world"}, "hello world", false},
+		{"cut mid-write", 8, []string{"hello ", "world"}, "hello wo", true},
+		{"writes after the cap", 6, []string{"hello ", "world", "!"}, "hello ", true},
+	}
+	for _, tt := range tests {
+		for _, compress := range []bool{false, true} {
+			dir := t.TempDir()
+			c := Capture{Dir: dir, MaxBytes: tt.max, Compress: compress}
+			cf := openCaptureFile(c, 1, HostEntry{Name: "web/1"}, "stdout")
+			received := 0
+			for _, w := range tt.writes {
+				// Write always reports everything, so the command never sees a
+				// short write.
+				if n, err := cf.Write([]byte(w)); n != len(w) || err != nil {
+					t.Errorf("%s: Write = %d, %v", tt.name, n, err)
+				}
+				received += len(w)
+			}
+			cf.close()
+
+			wantFile := "002-web_1.stdout"
+			if compress {
+				wantFile += ".gz"
+			}
+			info := cf.info
+			if info.File != wantFile || info.Bytes != int64(len(tt.want)) || info.Received != int64(received) || info.Truncated != tt.truncated || info.Error != "" {
+				t.Errorf("%s (compress %v): info = %+v", tt.name, compress, info)
+			}
+			if got := readCapture(t, filepath.Join(dir, info.File), compress); got != tt.want {
+				t.Errorf("%s (compress %v): file = %q, want %q", tt.name, compress, got, tt.want)
+			}
+		}
+	}
+}
+
+func readCapture(t *testing.T, path string, compress bool) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if compress {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	var b strings.Builder
+	if _, err := io.Copy(&b, r); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
@@ -0,0 +1,168 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"neurader/internal/netutil"
+)
+
+// SSHPort is the port children expose sshd on.
+const SSHPort = 22
+
+// dialFunc opens the transport for an SSH connection: a plain TCP dial,
+// or a direct-tcpip channel through a jump host's client.
+type dialFunc func(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error)
+
+func dialTCP(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: timeout}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// dialThrough returns a dialFunc that connects from jump's side of the
+// network. ssh.Client.Dial has no context, so a cancelled or timed-out
+// dial is abandoned and its channel closed once it completes.
+func dialThrough(jump *ssh.Client) dialFunc {
+	return func(ctx context.Context, addr string, timeout time.Duration) (net.Conn, error) {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		type dialed struct {
+			conn net.Conn
+			err  error
+		}
+		done := make(chan dialed, 1)
+		go func() {
+			// DialTCP keeps the target as the connection's RemoteAddr; names
+			// must go through Dial so they resolve on the jump host's side.
+			var conn net.Conn
+			var err error
+			if ap, perr := netip.ParseAddrPort(addr); perr == nil {
+				conn, err = jump.DialTCP("tcp", nil, net.TCPAddrFromAddrPort(ap))
+			} else {
+				conn, err = jump.Dial("tcp", addr)
+			}
+			done <- dialed{conn, err}
+		}()
+		select {
+		case d := <-done:
+			return d.conn, d.err
+		case <-ctx.Done():
+			go func() {
+				if d := <-done; d.conn != nil {
+					d.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dialHost connects to the first reachable address of host, so dual-stack
+// children are still managed when one address family is down. An
+// authentication failure is returned immediately: the host was reached,
+// and retrying another address would only hide the real problem.
+func dialHost(ctx context.Context, host HostEntry, config *ssh.ClientConfig, dial dialFunc) (*ssh.Client, error) {
+	var lastErr error
+	for _, addr := range host.Addresses() {
+		client, err := dialAddr(ctx, netutil.HostPort(addr, SSHPort), config, dial)
+		if err == nil {
+			return client, nil
+		}
+		if isAuthError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// RetryPolicy controls how connection establishment is retried. Only the
+// dial is retried, never the command, so nothing ever runs twice.
+type RetryPolicy struct {
+	Attempts   int           // retries after the first attempt; 0 disables
+	Backoff    time.Duration // delay before the first retry, doubled on each one
+	MaxBackoff time.Duration // cap on the delay; 0 means no cap
+}
+
+// DefaultRetryPolicy rides out a dropped SYN or a sshd restart without
+// noticeably slowing down runs against hosts that are really down.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Attempts: 2, Backoff: 500 * time.Millisecond, MaxBackoff: 5 * time.Second}
+}
+
+// delay is the wait before retry n (0-based): exponential backoff with
+// jitter in [d/2, d) so hosts failing together don't retry in lockstep.
+func (r RetryPolicy) delay(n int) time.Duration {
+	d := r.Backoff << uint(n)
+	if r.MaxBackoff > 0 && (d > r.MaxBackoff || d <= 0) {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// dialHostRetry is dialHost under a retry policy. Authentication
+// failures and cancellation are final.
+func dialHostRetry(ctx context.Context, host HostEntry, config *ssh.ClientConfig, retry RetryPolicy, dial dialFunc) (*ssh.Client, error) {
+	client, err := dialHost(ctx, host, config, dial)
+	for n := 0; err != nil && n < retry.Attempts; n++ {
+		if isAuthError(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-time.After(retry.delay(n)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		client, err = dialHost(ctx, host, config, dial)
+		if err != nil && n == retry.Attempts-1 && !isAuthError(err) && ctx.Err() == nil {
+			err = fmt.Errorf("%v (after %d attempts)", err, retry.Attempts+1)
+		}
+	}
+	return client, err
+}
+
+// dialAddr is ssh.Dial with cancellation: the connect honours ctx and
+// the connection is torn down if ctx ends mid-handshake.
+func dialAddr(ctx context.Context, addr string, config *ssh.ClientConfig, dial dialFunc) (*ssh.Client, error) {
+	conn, err := dial(ctx, addr, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func isAuthError(err error) bool {
+	return strings.Contains(err.Error(), "unable to authenticate")
+}
@@ -2,10 +2,13 @@ package ssh
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -15,7 +18,8 @@ import (
 	"time"
 
 	"golang.org/x/crypto/ssh"
-	"gopkg.in/yaml.v3"
+
+	"neurader/internal/inventory"
 )
 
 // Terminal Colors
@@ -26,14 +30,7 @@ const (
 	ColorYellow = "\033[33m"
 )
 
-type HostEntry struct {
-	Name string `yaml:"name"`
-	IP   string `yaml:"ip"`
-}
-
-type Inventory struct {
-	Hosts []HostEntry `yaml:"hosts"`
-}
+type HostEntry = inventory.HostEntry
 
 /* =========================
    SSH KEY MANAGEMENT
@@ -65,75 +62,187 @@ func GenerateMasterKeys() {
    REMOTE EXECUTION
 ========================= */
 
-func ExecuteRemote(target, command string) {
-	targetIP := resolveTarget(target)
+// cancelGrace is how long a cancelled remote command gets to exit after
+// SIGTERM before it is sent SIGKILL and the session is closed.
+const cancelGrace = 3 * time.Second
 
-	keyBytes, err := os.ReadFile("/etc/neurader/id_rsa")
-	if err != nil {
-		fmt.Println("[!] SSH private key not found. Run with sudo.")
-		return
+// ExecuteRemote runs command on a single alias or address, streaming its
+// output, and returns the structured result.
+func ExecuteRemote(ctx context.Context, target, command string) Result {
+	host, ok := loadInventory().Find(target)
+	if !ok {
+		host = HostEntry{Name: target, IP: target}
 	}
+	out := &streamPrinter{}
+	out.Start(host)
+	res := executeOnHost(ctx, out, host, command, nil, DefaultRetryPolicy(), nil)
+	out.Finish(res)
+	return res
+}
 
-	signer, err := ssh.ParsePrivateKey(keyBytes)
-	if err != nil {
-		fmt.Printf("[!] Key parse error: %v\n", err)
-		return
+// executeOnHost runs command on host until it exits or ctx ends, in which
+// case the remote command is terminated (see localSession). A non-nil
+// stdin is streamed to the command; retry applies to connecting only.
+// A non-nil capture also receives both streams untouched.
+func executeOnHost(ctx context.Context, out Output, host HostEntry, command string, stdin []byte, retry RetryPolicy, capture *hostCapture) (res Result) {
+	res = Result{Host: host, Command: command, ExitCode: -1}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	// Tee both streams into the result while still printing them live, and
+	// wait for the readers so trailing lines are never lost.
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	var stdoutBuf, stderrBuf bytes.Buffer
+	var streams sync.WaitGroup
+	streams.Add(2)
+	go func() {
+		defer streams.Done()
+		streamOutput(out, host, "stdout", io.TeeReader(stdoutR, &stdoutBuf))
+	}()
+	go func() {
+		defer streams.Done()
+		streamOutput(out, host, "stderr", io.TeeReader(stderrR, &stderrBuf))
+	}()
+
+	var in io.Reader
+	if stdin != nil {
+		in = bytes.NewReader(stdin)
 	}
+	spec := sessionSpec{Host: host, Command: command, Timeout: 5 * time.Second, Retry: retry}
+	stdout, stderr := capture.writers(stdoutW, stderrW)
+	info := runSession(ctx, spec, in, stdout, stderr)
+	stdoutW.Close()
+	stderrW.Close()
+	streams.Wait()
+	res.Stdout, res.Stderr = stdoutBuf.Bytes(), stderrBuf.Bytes()
+
+	switch {
+	case info.Phase == phaseKey:
+		res.Err = errors.New(info.Err)
+		return res
+	case info.Phase == phaseConnect && ctx.Err() != nil:
+		res.Cancelled, res.Err = true, cancelReason(ctx)
+		return res
+	case info.Phase == phaseConnect:
+		inventory.MarkError(host, errors.New(info.Err))
+		res.Err = fmt.Errorf("connection failed: %s", info.Err)
+		return res
+	}
+
+	_ = inventory.UpdateState(host, func(s *inventory.HostState) {
+		now := time.Now()
+		s.Seen(now)
+		s.LastRun = now
+	})
 
-	config := &ssh.ClientConfig{
-		User:            "neurader",
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         5 * time.Second,
+	res.applyExit(info)
+	if ctx.Err() != nil {
+		res.Cancelled, res.Err = true, cancelReason(ctx)
 	}
+	return res
+}
 
-	client, err := ssh.Dial("tcp", targetIP+":22", config)
+// ExecuteRemoteMulti expands targets (aliases, IPs or @groups), renders
+// the command template for each host and runs it according to opts
+// (parallelism, rolling batches, failure threshold). Results come back in
+// target order, followed by a printed summary table.
+func ExecuteRemoteMulti(ctx context.Context, targets []string, command string, opts RunOptions) ([]Result, error) {
+	out, err := NewOutput(opts.Output)
 	if err != nil {
-		fmt.Printf("[%s] %sConnection failed%s: %v\n", target, ColorRed, ColorReset, err)
-		return
+		return nil, err
 	}
-	defer client.Close()
+	return ExecuteRemoteMultiTo(ctx, out, targets, command, opts)
+}
 
-	session, err := client.NewSession()
+// ExecuteRemoteMultiTo is ExecuteRemoteMulti reporting to out instead of
+// the output mode named in opts.
+func ExecuteRemoteMultiTo(ctx context.Context, out Output, targets []string, command string, opts RunOptions) ([]Result, error) {
+	cmds, err := RenderMulti(targets, command, opts.Templated)
 	if err != nil {
-		fmt.Printf("[%s] Session error: %v\n", target, err)
-		return
+		return nil, err
 	}
-	defer session.Close()
+	return executeMulti(ctx, out, cmds, nil, opts)
+}
 
-	stdout, _ := session.StdoutPipe()
-	stderr, _ := session.StderrPipe()
+// ExecuteCommands runs commands rendered by the caller, one per host,
+// through the normal dispatch (batches, breaker, become). Callers that
+// build their own per-host data, such as playbooks, use it instead of
+// ExecuteRemoteMultiTo.
+func ExecuteCommands(ctx context.Context, out Output, cmds []RenderedCommand, opts RunOptions) ([]Result, error) {
+	return executeMulti(ctx, out, cmds, nil, opts)
+}
 
-	if err := session.Start(command); err != nil {
-		fmt.Printf("[%s] Start failed: %v\n", target, err)
-		return
+// executeMulti runs already-rendered commands according to opts, feeding
+// each host its own copy of stdin when it is non-nil, or the command's own
+// Stdin if it has one.
+func executeMulti(ctx context.Context, out Output, cmds []RenderedCommand, stdin []byte, opts RunOptions) ([]Result, error) {
+	out.Info("[*] Executing on %d host(s)", len(cmds))
+	st := inventory.LoadState()
+	started := time.Now()
+
+	captures := make([]*hostCapture, len(cmds))
+	if opts.Capture.Dir != "" {
+		if err := os.MkdirAll(opts.Capture.Dir, 0700); err != nil {
+			return nil, fmt.Errorf("output dir: %v", err)
+		}
 	}
 
-	go streamOutput(target, stdout)
-	go streamOutput(target, stderr)
+	run := func(i int) Result {
+		rc := cmds[i]
+		if rc.Err != nil {
+			res := Result{Host: rc.Host, Command: rc.Command, ExitCode: -1, Err: fmt.Errorf("template: %v", rc.Err)}
+			out.Finish(res)
+			return res
+		}
+		if err := opts.circuitOpen(st, rc.Host); err != nil {
+			res := Result{Host: rc.Host, Command: rc.Command, ExitCode: -1, Skipped: true, Err: err}
+			out.Finish(res)
+			return res
+		}
 
-	session.Wait()
-}
+		hostCtx := ctx
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			hostCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
 
-func ExecuteRemoteMulti(targets []string, command string) {
-	var wg sync.WaitGroup
-	fmt.Printf("[*] Executing on %d host(s)\n\n", len(targets))
+		out.Start(rc.Host)
+		if opts.Capture.Dir != "" {
+			captures[i] = opts.Capture.open(i, rc.Host)
+			defer captures[i].close()
+		}
+		in := stdin
+		if rc.Stdin != nil {
+			in = rc.Stdin
+		}
+		res := executeOnHost(hostCtx, out, rc.Host, opts.Become.Wrap(rc.Command), in, opts.Retry, captures[i])
+		res.Command = rc.Command
+		if err := becomeError(opts.Become, res.ExitCode, res.Stderr); err != nil {
+			res.Err = err
+		}
+		out.Finish(res)
+		return res
+	}
+	skip := func(i int, reason error) Result {
+		return Result{Host: cmds[i].Host, Command: cmds[i].Command, ExitCode: -1, Skipped: true, Err: reason}
+	}
+
+	results, err := runBatches(ctx, out, len(cmds), opts, run, skip)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, t := range targets {
-		target := strings.TrimSpace(t)
-		if target == "" {
-			continue
+	if opts.Capture.Dir != "" {
+		if err := opts.Capture.writeManifest(started, results, captures); err != nil {
+			out.Info("[!] Could not write the output manifest: %v", err)
+		} else {
+			out.Info("[*] Raw output saved in %s (see %s)", opts.Capture.Dir, ManifestName)
 		}
-		wg.Add(1)
-		go func(host string) {
-			defer wg.Done()
-			fmt.Printf("%s[%s]%s\n", ColorYellow, host, ColorReset)
-			ExecuteRemote(host, command)
-			fmt.Println()
-		}(target)
 	}
-	wg.Wait()
-	fmt.Println("[+] Execution finished.")
+	out.Close(results)
+	return results, nil
 }
 
 /* =========================
@@ -141,138 +250,172 @@ func ExecuteRemoteMulti(targets []string, command string) {
 ========================= */
 
 func ExecuteRemoteWithInput(targetIP, command string, input []byte) error {
-	keyBytes, err := os.ReadFile("/etc/neurader/id_rsa")
-	if err != nil {
-		return fmt.Errorf("private key not found")
+	host, ok := loadInventory().Find(targetIP)
+	if !ok {
+		host = HostEntry{Name: targetIP, IP: targetIP}
 	}
+	return executeWithInput(host, command, input)
+}
 
-	signer, _ := ssh.ParsePrivateKey(keyBytes)
-	config := &ssh.ClientConfig{
-		User:            "neurader",
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
-	}
+// executeWithInput feeds input to command on an inventory entry, keeping
+// its route: an address alone may match several hosts behind jump hosts.
+func executeWithInput(host HostEntry, command string, input []byte) error {
+	spec := sessionSpec{Host: host, Command: command, Timeout: 10 * time.Second}
+	info := runSession(context.Background(), spec, bytes.NewReader(input), io.Discard, io.Discard)
+	return info.error()
+}
 
-	client, err := ssh.Dial("tcp", targetIP+":22", config)
-	if err != nil {
-		return err
+func ListHosts() {
+	inv := loadInventory()
+	if len(inv.Hosts) == 0 {
+		fmt.Println("No hosts in inventory.")
+		return
 	}
-	defer client.Close()
 
-	session, err := client.NewSession()
-	if err != nil {
-		return err
+	// Check all hosts in parallel; each check persists its findings to
+	// state.yml, which is then read back for the table.
+	// Statuses are indexed by position: hosts behind different jump hosts
+	// may share an address.
+	var wg sync.WaitGroup
+	statuses := make([]string, len(inv.Hosts))
+
+	for i, h := range inv.Hosts {
+		wg.Add(1)
+		go func(i int, host HostEntry) {
+			defer wg.Done()
+			statuses[i] = checkStatus(host)
+		}(i, h)
 	}
-	defer session.Close()
+	wg.Wait()
 
-	stdin, err := session.StdinPipe()
-	if err != nil {
-		return err
+	st := inventory.LoadState()
+
+	// Using tabwriter for clean column alignment. Every cell in a coloured
+	// column carries the same escape sequences so widths stay aligned.
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tIP ADDRESS\tSTATUS\tVERSION\tLAST SEEN\tLAST RUN\tLAST ERROR")
+	fmt.Fprintln(w, "-----\t----------\t------\t-------\t---------\t--------\t----------")
+	for i, h := range inv.Hosts {
+		rec := st.Hosts[inventory.StateKey(h)]
+		version := rec.Version
+		if version == "" {
+			version = "-"
+		}
+		addr := h.IP
+		if h.Via != "" {
+			addr += " via " + h.Via
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			h.Name, addr, statuses[i], version,
+			staleness(rec.LastSeen), formatAge(rec.LastRun), lastError(rec))
 	}
+	w.Flush()
+}
 
-	err = session.Start(command)
-	if err != nil {
-		return err
+// Updated checkStatus to verify actual SSH access and record the result.
+// The probe asks the child's neurader binary for its version, so a Ready
+// host also reports what build it runs.
+func checkStatus(host HostEntry) string {
+	var out bytes.Buffer
+	spec := sessionSpec{Host: host, Command: "/usr/local/bin/neurader version", Timeout: 2 * time.Second} // Quick timeout for status checks
+	info := runSession(context.Background(), spec, nil, &out, io.Discard)
+
+	switch info.Phase {
+	case phaseKey:
+		if strings.Contains(info.Err, "not found") {
+			return ColorYellow + "● Key Missing" + ColorReset
+		}
+		return ColorRed + "● Key Error" + ColorReset
+	case phaseConnect:
+		// Distinguish between "Port Closed" and "Permission Denied"
+		if isAuthError(errors.New(info.Err)) {
+			_ = inventory.UpdateState(host, func(s *inventory.HostState) {
+				s.Synced = false
+				s.Failed(errors.New(info.Err), time.Now())
+			})
+			return ColorYellow + "● Not Synced" + ColorReset
+		}
+		inventory.MarkError(host, errors.New(info.Err))
+		return ColorRed + "● Offline" + ColorReset
 	}
 
-	stdin.Write(input)
-	stdin.Close()
+	version := ""
+	if info.Code == 0 {
+		version = parseVersion(out.String())
+	}
+	_ = inventory.UpdateState(host, func(s *inventory.HostState) {
+		s.Seen(time.Now())
+		s.Synced = true
+		if version != "" {
+			s.Version = version
+		}
+	})
 
-	return session.Wait()
+	return ColorGreen + "● Ready" + ColorReset
 }
 
-func ListHosts() {
-    inv := loadInventory()
-    if len(inv.Hosts) == 0 {
-        fmt.Println("No hosts in inventory.")
-        return
-    }
-
-    // Using tabwriter for clean column alignment
-    w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-    fmt.Fprintln(w, "ALIAS\tIP ADDRESS\tSTATUS")
-    fmt.Fprintln(w, "-----\t----------\t------")
-
-    var wg sync.WaitGroup
-    statusMap := make(map[string]string)
-    var mu sync.Mutex
-
-    // Check all hosts in parallel
-    for _, h := range inv.Hosts {
-        wg.Add(1)
-        go func(ip string) {
-            defer wg.Done()
-            s := checkStatus(ip)
-            mu.Lock()
-            statusMap[ip] = s
-            mu.Unlock()
-        }(h.IP)
-    }
-    wg.Wait()
-
-    for _, h := range inv.Hosts {
-        fmt.Fprintf(w, "%s\t%s\t%s\n", h.Name, h.IP, statusMap[h.IP])
-    }
-    w.Flush()
+// parseVersion extracts the version from "neurader Version: v2.0.0".
+func parseVersion(out string) string {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
 }
 
-// Updated checkStatus to verify actual SSH access
-func checkStatus(ip string) string {
-    keyBytes, err := os.ReadFile("/etc/neurader/id_rsa")
-    if err != nil {
-        return ColorYellow + "● Key Missing" + ColorReset
-    }
-
-    signer, err := ssh.ParsePrivateKey(keyBytes)
-    if err != nil {
-        return ColorRed + "● Key Error" + ColorReset
-    }
-
-    config := &ssh.ClientConfig{
-        User:            "neurader",
-        Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-        HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-        Timeout:         2 * time.Second, // Quick timeout for status checks
-    }
-
-    // Attempt actual SSH connection
-    client, err := ssh.Dial("tcp", ip+":22", config)
-    if err != nil {
-        // Distinguish between "Port Closed" and "Permission Denied"
-        if strings.Contains(err.Error(), "unable to authenticate") {
-            return ColorYellow + "● Not Synced" + ColorReset
-        }
-        return ColorRed + "● Offline" + ColorReset
-    }
-    defer client.Close()
-
-    return ColorGreen + "● Ready" + ColorReset
+// staleness renders the age of the last contact, coloured by how stale it
+// is: green within 5 minutes, yellow within a day, red beyond that.
+func staleness(t time.Time) string {
+	if t.IsZero() {
+		return ColorRed + "never" + ColorReset
+	}
+	age := time.Since(t)
+	color := ColorRed
+	switch {
+	case age < 5*time.Minute:
+		color = ColorGreen
+	case age < 24*time.Hour:
+		color = ColorYellow
+	}
+	return color + formatAge(t) + ColorReset
 }
 
-func streamOutput(target string, reader io.Reader) {
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		fmt.Printf("[%s] %s\n", target, scanner.Text())
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	age := time.Since(t)
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds ago", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
 	}
 }
 
-func resolveTarget(target string) string {
-	inv := loadInventory()
-	for _, h := range inv.Hosts {
-		if h.Name == target {
-			return h.IP
-		}
+// lastError shows the most recent error only if it is newer than the last
+// successful contact; older errors have since been resolved.
+func lastError(rec inventory.HostState) string {
+	if rec.LastError == "" || rec.LastErrorAt.Before(rec.LastSeen) {
+		return "-"
 	}
-	return target 
+	return fmt.Sprintf("%s (%s)", Truncate(rec.LastError, 40), formatAge(rec.LastErrorAt))
 }
 
-func loadInventory() Inventory {
-	var inv Inventory
-	data, err := os.ReadFile("/etc/neurader/hosts.yml")
-	if err != nil {
-		return inv
+func streamOutput(out Output, host HostEntry, stream string, reader io.Reader) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		out.Line(host, stream, scanner.Text())
 	}
-	yaml.Unmarshal(data, &inv)
-	return inv
+	// Keep draining if the scanner gave up (e.g. an oversized line) so the
+	// session is never blocked writing to us.
+	io.Copy(io.Discard, reader)
+}
+
+func loadInventory() inventory.Inventory {
+	return inventory.Load(inventory.Path)
 }
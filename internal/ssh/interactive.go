@@ -0,0 +1,147 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+
+	"neurader/internal/audit"
+	"neurader/internal/inventory"
+)
+
+/* =========================
+   INTERACTIVE SESSIONS
+========================= */
+
+// forwardedSignals are relayed to the remote side. In raw mode the
+// terminal no longer turns Ctrl-C into SIGINT (the byte goes to the remote
+// PTY instead), so these only arrive when sent to neurader explicitly.
+var forwardedSignals = map[os.Signal]ssh.Signal{
+	syscall.SIGINT:  ssh.SIGINT,
+	syscall.SIGTERM: ssh.SIGTERM,
+	syscall.SIGHUP:  ssh.SIGHUP,
+	syscall.SIGQUIT: ssh.SIGQUIT,
+}
+
+// Interactive opens a login shell (or runs command, if given) on target
+// with a PTY attached to the local terminal. The session's output is
+// recorded under audit.SessionsDir and its start and end are written to
+// the audit log. It returns the remote exit code.
+func Interactive(target, command string) (int, error) {
+	host, ok := loadInventory().Find(target)
+	if !ok {
+		host = HostEntry{Name: target, IP: target}
+	}
+
+	client, err := defaultPool.Get(context.Background(), host, 10*time.Second, DefaultRetryPolicy())
+	if err != nil {
+		if !errors.As(err, new(keyError)) {
+			inventory.MarkError(host, err)
+		}
+		return -1, fmt.Errorf("connection failed: %v", err)
+	}
+	defer defaultPool.Release(host)
+	inventory.MarkSeen(host)
+
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, fmt.Errorf("session error: %v", err)
+	}
+	defer session.Close()
+
+	fd := int(os.Stdin.Fd())
+	tty := term.IsTerminal(fd)
+	width, height := 80, 24
+	if tty {
+		if w, h, err := term.GetSize(fd); err == nil {
+			width, height = w, h
+		}
+	}
+
+	title := "neurader ssh " + host.Name
+	if command != "" {
+		title += " " + command
+	}
+	rec, err := audit.NewRecording(host.Name, width, height, title)
+	if err != nil {
+		return -1, fmt.Errorf("cannot record session: %v", err)
+	}
+	defer rec.Close()
+
+	addr := client.RemoteAddr().String()
+	_ = audit.Record(audit.Event{Action: "ssh.open", Host: host.Name, Addr: addr, Command: command, Recording: rec.Path})
+	fmt.Fprintf(os.Stderr, "[*] Connected to %s (%s). Session recorded to %s\n", host.Name, addr, rec.Path)
+
+	if tty {
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return -1, fmt.Errorf("pty request failed: %v", err)
+		}
+	}
+
+	session.Stdin = os.Stdin
+	session.Stdout = io.MultiWriter(os.Stdout, rec)
+	session.Stderr = io.MultiWriter(os.Stderr, rec)
+
+	if command != "" {
+		err = session.Start(command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return -1, fmt.Errorf("start failed: %v", err)
+	}
+
+	// Raw mode only once the remote side is ready; it is restored as soon
+	// as the session ends so later messages land on a sane terminal.
+	restore := func() {}
+	if tty {
+		if state, err := term.MakeRaw(fd); err == nil {
+			restore = func() { term.Restore(fd, state) }
+		}
+	}
+
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, syscall.SIGWINCH, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
+	go func() {
+		for sig := range sigs {
+			if sig == syscall.SIGWINCH {
+				if w, h, err := term.GetSize(fd); tty && err == nil {
+					session.WindowChange(h, w)
+					rec.Resize(w, h)
+				}
+				continue
+			}
+			session.Signal(forwardedSignals[sig])
+		}
+	}()
+
+	start := time.Now()
+	info := toExitInfo(session.Wait())
+	restore()
+	inventory.MarkSeen(host)
+
+	code := info.Code
+	ev := audit.Event{Action: "ssh.close", Host: host.Name, Addr: addr, Recording: rec.Path, ExitCode: &code, Duration: time.Since(start).Round(time.Second).String()}
+	if info.Signal != "" {
+		ev.Error = "killed by signal " + info.Signal
+	} else if info.Err != "" && !strings.Contains(info.Err, "without an exit status") {
+		ev.Error = info.Err
+	}
+	_ = audit.Record(ev)
+	return code, nil
+}
@@ -0,0 +1,282 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   OUTPUT MODES
+========================= */
+
+// Output receives everything a multi-host run produces. streamOutput feeds
+// it line by line; each mode decides when and how to print.
+type Output interface {
+	Info(format string, args ...interface{})  // progress messages (batches, pauses)
+	Start(host HostEntry)                     // a host is about to run
+	Line(host HostEntry, stream, line string) // one line of stdout or stderr
+	Finish(res Result)                        // a host completed (or failed to start)
+	Close(results []Result)                   // the run is over
+}
+
+// OutputModes lists the values accepted by --output.
+var OutputModes = []string{"stream", "grouped", "json", "summary"}
+
+// NewOutput builds the Output for a --output mode.
+func NewOutput(mode string) (Output, error) {
+	switch mode {
+	case "", "stream":
+		return &streamPrinter{}, nil
+	case "grouped":
+		return &groupedPrinter{lines: map[string][]string{}}, nil
+	case "json":
+		return &jsonPrinter{enc: json.NewEncoder(os.Stdout), finished: map[string]bool{}}, nil
+	case "summary":
+		return &summaryPrinter{lines: map[string][]string{}}, nil
+	}
+	return nil, fmt.Errorf("unknown output mode %q (want %s)", mode, strings.Join(OutputModes, "|"))
+}
+
+// stream: lines are printed as they arrive, prefixed with the host.
+type streamPrinter struct{}
+
+func (p *streamPrinter) Info(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (p *streamPrinter) Start(host HostEntry) {
+	fmt.Printf("%s[%s]%s\n", ColorYellow, host.Name, ColorReset)
+}
+
+func (p *streamPrinter) Line(host HostEntry, stream, line string) {
+	fmt.Printf("[%s] %s\n", host.Name, line)
+}
+
+func (p *streamPrinter) Finish(res Result) {
+	if res.Err != nil && !res.Cancelled {
+		fmt.Printf("[%s] %sError%s: %v\n", res.Host.Name, ColorRed, ColorReset, res.Err)
+	}
+	fmt.Println()
+}
+
+func (p *streamPrinter) Close(results []Result) {
+	PrintSummary(results)
+}
+
+// grouped: each host's output is buffered and printed as one block when
+// the host finishes, so hosts never interleave.
+type groupedPrinter struct {
+	mu    sync.Mutex
+	lines map[string][]string
+}
+
+func (p *groupedPrinter) Info(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Printf(format+"\n", args...)
+}
+
+func (p *groupedPrinter) Start(host HostEntry) {}
+
+func (p *groupedPrinter) Line(host HostEntry, stream, line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lines[outputKey(host)] = append(p.lines[outputKey(host)], line)
+}
+
+func (p *groupedPrinter) Finish(res Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	color := ColorGreen
+	if !res.OK() {
+		color = ColorRed
+	}
+	fmt.Printf("%s=== %s (%s) ===%s\n", color, res.Host.Name, res.Status(), ColorReset)
+	for _, l := range p.lines[outputKey(res.Host)] {
+		fmt.Println(l)
+	}
+	if res.Err != nil {
+		fmt.Printf("%s[!] %v%s\n", ColorRed, res.Err, ColorReset)
+	}
+	fmt.Println()
+	delete(p.lines, outputKey(res.Host))
+}
+
+func (p *groupedPrinter) Close(results []Result) {
+	PrintSummary(results)
+}
+
+// json: one JSON object per line of output and per host result, plus a
+// final summary object. Progress messages go to stderr so stdout stays
+// machine-readable.
+type jsonPrinter struct {
+	mu         sync.Mutex
+	enc        *json.Encoder
+	finished   map[string]bool
+	infoEvents bool // record Info messages as events instead of printing them
+}
+
+// NewJSONOutput writes the json output mode's events to w, including
+// progress messages as "info" events, e.g. for a job's output log.
+func NewJSONOutput(w io.Writer) Output {
+	return &jsonPrinter{enc: json.NewEncoder(w), finished: map[string]bool{}, infoEvents: true}
+}
+
+type jsonEvent struct {
+	Type       string `json:"type"`
+	Host       string `json:"host,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Stream     string `json:"stream,omitempty"`
+	Line       string `json:"line,omitempty"`
+	Status     string `json:"status,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Signal     string `json:"signal,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Time       string `json:"time,omitempty"`
+	OK         *int   `json:"ok,omitempty"`
+	Failed     *int   `json:"failed,omitempty"`
+}
+
+func (p *jsonPrinter) emit(ev jsonEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.enc.Encode(ev)
+}
+
+func (p *jsonPrinter) Info(format string, args ...interface{}) {
+	if p.infoEvents {
+		p.emit(jsonEvent{Type: "info", Line: fmt.Sprintf(format, args...),
+			Time: time.Now().UTC().Format(time.RFC3339Nano)})
+		return
+	}
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+func (p *jsonPrinter) Start(host HostEntry) {}
+
+func (p *jsonPrinter) Line(host HostEntry, stream, line string) {
+	p.emit(jsonEvent{Type: "line", Host: host.Name, Stream: stream, Line: line,
+		Time: time.Now().UTC().Format(time.RFC3339Nano)})
+}
+
+func (p *jsonPrinter) Finish(res Result) {
+	p.mu.Lock()
+	p.finished[outputKey(res.Host)] = true
+	p.mu.Unlock()
+	p.emit(resultEvent(res))
+}
+
+func (p *jsonPrinter) Close(results []Result) {
+	ok, failed := 0, 0
+	for _, r := range results {
+		if r.Skipped && !p.finished[outputKey(r.Host)] {
+			// Hosts skipped by an aborted run never reached Finish.
+			p.emit(resultEvent(r))
+		}
+		if r.OK() {
+			ok++
+		} else {
+			failed++
+		}
+	}
+	p.emit(jsonEvent{Type: "summary", OK: &ok, Failed: &failed})
+}
+
+func resultEvent(r Result) jsonEvent {
+	ev := jsonEvent{
+		Type:       "result",
+		Host:       r.Host.Name,
+		Address:    r.Host.IP,
+		Status:     r.Status(),
+		Signal:     r.Signal,
+		DurationMS: r.Duration.Milliseconds(),
+	}
+	if r.ExitCode >= 0 {
+		code := r.ExitCode
+		ev.ExitCode = &code
+	}
+	if r.Err != nil {
+		ev.Error = r.Err.Error()
+	}
+	return ev
+}
+
+// outputKey identifies a host within one run; aliases sharing an address
+// are still kept apart.
+func outputKey(h HostEntry) string {
+	return h.Name + "|" + h.Key()
+}
+
+// summary: like dshbak -c, hosts that produced identical output are
+// collapsed into a single block headed by the list of hosts.
+type summaryPrinter struct {
+	mu    sync.Mutex
+	lines map[string][]string
+}
+
+func (p *summaryPrinter) Info(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func (p *summaryPrinter) Start(host HostEntry) {}
+
+func (p *summaryPrinter) Line(host HostEntry, stream, line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lines[outputKey(host)] = append(p.lines[outputKey(host)], line)
+}
+
+func (p *summaryPrinter) Finish(res Result) {}
+
+func (p *summaryPrinter) Close(results []Result) {
+	type block struct {
+		hosts  []string
+		output string
+	}
+	var order []string
+	blocks := map[string]*block{}
+	for _, r := range results {
+		out := strings.Join(p.lines[outputKey(r.Host)], "\n")
+		if r.Err != nil {
+			out += fmt.Sprintf("\n%s[!] %v%s", ColorRed, r.Err, ColorReset)
+		}
+		key := r.Status() + "\x00" + out
+		b, ok := blocks[key]
+		if !ok {
+			b = &block{output: out}
+			blocks[key] = b
+			order = append(order, key)
+		}
+		b.hosts = append(b.hosts, r.Host.Name)
+	}
+
+	for _, key := range order {
+		b := blocks[key]
+		sort.Strings(b.hosts)
+		header := fmt.Sprintf("%s (%d)", strings.Join(b.hosts, ","), len(b.hosts))
+		rule := strings.Repeat("-", len(header))
+		fmt.Printf("%s%s\n%s\n%s%s\n", ColorYellow, rule, header, rule, ColorReset)
+		if b.output != "" {
+			fmt.Println(strings.TrimLeft(b.output, "\n"))
+		}
+		fmt.Println()
+	}
+	PrintSummary(results)
+}
+
+// Truncate shortens s to at most max runes for a table column, marking
+// the cut with "...". It never splits a multi-byte character.
+func Truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-3]) + "..."
+}
@@ -0,0 +1,231 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/* ========================================================================
+   CONNECTION POOL
+   Authenticated clients are kept per host and reused for every session,
+   so repeated commands skip the key parse and SSH handshake. In the
+   daemon the pool is long-lived and kept warm with keepalives; CLI
+   invocations borrow it over the control socket (see session.go). Hosts
+   that declare "via" are dialed through their jump host's pooled client.
+   ======================================================================== */
+
+const MasterKeyPath = "/etc/neurader/id_rsa"
+
+type Pool struct {
+	mu      sync.Mutex
+	entries map[string]*poolEntry
+
+	signerMu sync.Mutex
+	signer   ssh.Signer
+	keyMod   time.Time
+}
+
+type poolEntry struct {
+	mu       sync.Mutex // held while dialing so one host is dialed once
+	client   *ssh.Client
+	lastUsed time.Time
+	active   int // sessions currently borrowing client
+}
+
+// defaultPool serves every session in this process.
+var defaultPool = NewPool()
+
+func NewPool() *Pool {
+	return &Pool{entries: map[string]*poolEntry{}}
+}
+
+// keyError marks failures to load the master key, as opposed to failures
+// reaching the host.
+type keyError struct{ err error }
+
+func (e keyError) Error() string { return e.err.Error() }
+
+// loadSigner parses the master key once, re-reading it only if the file
+// changes (e.g. after the wizard regenerates it).
+func (p *Pool) loadSigner() (ssh.Signer, error) {
+	p.signerMu.Lock()
+	defer p.signerMu.Unlock()
+
+	info, err := os.Stat(MasterKeyPath)
+	if err != nil {
+		return nil, keyError{fmt.Errorf("SSH private key not found. Run with sudo")}
+	}
+	if p.signer != nil && info.ModTime().Equal(p.keyMod) {
+		return p.signer, nil
+	}
+
+	keyBytes, err := os.ReadFile(MasterKeyPath)
+	if err != nil {
+		return nil, keyError{fmt.Errorf("SSH private key not found. Run with sudo")}
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, keyError{fmt.Errorf("key parse error: %v", err)}
+	}
+	p.signer, p.keyMod = signer, info.ModTime()
+	return signer, nil
+}
+
+// clientConfig is the single place the neurader SSH identity is defined.
+func clientConfig(signer ssh.Signer, timeout time.Duration) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User:            "neurader",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         timeout,
+	}
+}
+
+// Get returns a live client for host, dialing (under retry) only if none
+// is pooled. Every successful Get must be paired with Release.
+func (p *Pool) Get(ctx context.Context, host HostEntry, timeout time.Duration, retry RetryPolicy) (*ssh.Client, error) {
+	signer, err := p.loadSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	e, ok := p.entries[host.RouteKey()]
+	if !ok {
+		e = &poolEntry{}
+		p.entries[host.RouteKey()] = e
+	}
+	p.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == nil {
+		client, err := p.dial(ctx, host, clientConfig(signer, timeout), retry)
+		if err != nil {
+			return nil, err
+		}
+		e.client = client
+	}
+	e.lastUsed = time.Now()
+	e.active++
+	return e.client, nil
+}
+
+// dial connects to host directly, or through the host named by its via.
+// The jump host's client is borrowed from the pool for as long as the
+// connection through it is open, which also keeps it alive and warm.
+func (p *Pool) dial(ctx context.Context, host HostEntry, config *ssh.ClientConfig, retry RetryPolicy) (*ssh.Client, error) {
+	if host.Via == "" {
+		return dialHostRetry(ctx, host, config, retry, dialTCP)
+	}
+	inv := loadInventory()
+	if _, err := inv.Route(host); err != nil {
+		return nil, err
+	}
+	jumpHost, _ := inv.Find(host.Via)
+
+	jump, err := p.Get(ctx, jumpHost, config.Timeout, retry)
+	if err != nil {
+		return nil, fmt.Errorf("via %s: %w", jumpHost.Name, err)
+	}
+	client, err := dialHostRetry(ctx, host, config, retry, dialThrough(jump))
+	if err != nil {
+		p.Release(jumpHost)
+		return nil, fmt.Errorf("%v (via %s)", err, jumpHost.Name)
+	}
+	go func() {
+		client.Wait()
+		p.Release(jumpHost)
+	}()
+	return client, nil
+}
+
+// Release returns a client borrowed with Get.
+func (p *Pool) Release(host HostEntry) {
+	p.mu.Lock()
+	e, ok := p.entries[host.RouteKey()]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active--
+	e.lastUsed = time.Now()
+}
+
+// Drop closes client and forgets it if it is still the pooled one, e.g.
+// when a session cannot be opened on it any more.
+func (p *Pool) Drop(host HostEntry, client *ssh.Client) {
+	p.mu.Lock()
+	e, ok := p.entries[host.RouteKey()]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == client {
+		e.client.Close()
+		e.client = nil
+	}
+}
+
+// Keepalive pings every pooled client each interval, dropping clients
+// that stop answering or have been idle longer than idle. It never returns.
+func (p *Pool) Keepalive(interval, idle time.Duration) {
+	for range time.Tick(interval) {
+		p.mu.Lock()
+		entries := make([]*poolEntry, 0, len(p.entries))
+		for _, e := range p.entries {
+			entries = append(entries, e)
+		}
+		p.mu.Unlock()
+
+		for _, e := range entries {
+			go p.ping(e, interval, idle)
+		}
+	}
+}
+
+func (p *Pool) ping(e *poolEntry, timeout, idle time.Duration) {
+	e.mu.Lock()
+	client, lastUsed, active := e.client, e.lastUsed, e.active
+	e.mu.Unlock()
+	if client == nil {
+		return
+	}
+
+	alive := false
+	inUse := active > 0 || time.Since(lastUsed) < idle
+	if inUse {
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			alive = err == nil
+		case <-time.After(timeout):
+		}
+	}
+	if alive {
+		return
+	}
+
+	e.mu.Lock()
+	// An idle client may have been borrowed since it was looked at; only
+	// one that stopped answering is closed regardless.
+	stillIdle := e.active == 0 && time.Since(e.lastUsed) >= idle
+	if e.client == client && (inUse || stillIdle) {
+		e.client.Close()
+		e.client = nil
+	}
+	e.mu.Unlock()
+}
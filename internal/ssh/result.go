@@ -0,0 +1,134 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+/* =========================
+   EXECUTION RESULTS
+========================= */
+
+var (
+	ErrTimeout     = errors.New("timed out")
+	ErrInterrupted = errors.New("interrupted")
+)
+
+// cancelReason maps a finished context to ErrTimeout or ErrInterrupted.
+func cancelReason(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ErrInterrupted
+}
+
+// Result describes one command on one host. ExitCode is -1 when the
+// command never produced an exit status (connection failure, killed by a
+// signal, session dropped); Err then explains why.
+type Result struct {
+	Host      HostEntry
+	Command   string
+	ExitCode  int
+	Signal    string
+	Stdout    []byte
+	Stderr    []byte
+	Duration  time.Duration
+	Skipped   bool // never attempted because the run was aborted or cancelled
+	Cancelled bool // stopped by timeout or interrupt while running
+	Err       error
+}
+
+// OK reports whether the command ran and exited 0.
+func (r Result) OK() bool {
+	return r.Err == nil && r.Signal == "" && r.ExitCode == 0
+}
+
+// Status is a short human label for the summary table.
+func (r Result) Status() string {
+	switch {
+	case r.OK():
+		return "ok"
+	case r.Skipped:
+		return "skipped"
+	case r.Cancelled && errors.Is(r.Err, ErrTimeout):
+		return "timeout"
+	case r.Cancelled:
+		return "cancelled"
+	case errors.Is(r.Err, ErrSudoDenied):
+		return "sudo denied"
+	case r.Signal != "":
+		return "signal " + r.Signal
+	case r.ExitCode > 0:
+		return "failed"
+	default:
+		return "error"
+	}
+}
+
+// applyExit records how the session ended.
+func (r *Result) applyExit(info exitInfo) {
+	r.ExitCode, r.Signal = info.Code, info.Signal
+	if info.Err != "" {
+		r.Err = errors.New(info.Err)
+	}
+}
+
+// AnyFailed reports whether at least one result is not OK.
+func AnyFailed(results []Result) bool {
+	for _, r := range results {
+		if !r.OK() {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintSummary prints a per-host table and an ok/failed tally.
+func PrintSummary(results []Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST\tSTATUS\tEXIT\tDURATION\tERROR")
+	fmt.Fprintln(w, "----\t------\t----\t--------\t-----")
+
+	failed, skipped, cancelled := 0, 0, 0
+	for _, r := range results {
+		color := ColorGreen
+		switch {
+		case r.Skipped:
+			color = ColorYellow
+			skipped++
+		case r.Cancelled:
+			color = ColorYellow
+			cancelled++
+		case !r.OK():
+			color = ColorRed
+			failed++
+		}
+		exit := "-"
+		if r.ExitCode >= 0 {
+			exit = fmt.Sprint(r.ExitCode)
+		}
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s%s%s\t%s\t%s\t%s\n",
+			r.Host.Name, color, r.Status(), ColorReset, exit,
+			r.Duration.Round(time.Millisecond), errMsg)
+	}
+	w.Flush()
+
+	ok := len(results) - failed - skipped - cancelled
+	switch {
+	case skipped > 0 || cancelled > 0:
+		fmt.Printf("\n%s[!] Execution aborted: %d ok, %d failed, %d cancelled, %d skipped.%s\n",
+			ColorRed, ok, failed, cancelled, skipped, ColorReset)
+	case failed > 0:
+		fmt.Printf("\n%s[!] Execution finished: %d ok, %d failed.%s\n", ColorRed, ok, failed, ColorReset)
+	default:
+		fmt.Printf("\n%s[+] Execution finished: %d ok.%s\n", ColorGreen, len(results), ColorReset)
+	}
+}
@@ -0,0 +1,97 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/* =========================
+   LOCAL SCRIPTS ON REMOTE HOSTS
+========================= */
+
+// ExecuteScript streams a local script to every target and runs it there
+// with args. The script is written to a private temp file on the host and
+// run through the interpreter named in its shebang (so it works even when
+// /tmp is mounted noexec); the temp file is removed however the script
+// ends, and termination signals are forwarded to it.
+func ExecuteScript(ctx context.Context, targets []string, path string, args []string, opts RunOptions) ([]Result, error) {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read script: %v", err)
+	}
+
+	command := scriptCommand(Interpreter(script), args)
+
+	// The wrapper is fixed shell, never a template; the script itself is
+	// sent byte for byte.
+	cmds, err := RenderMulti(targets, command, false)
+	if err != nil {
+		return nil, err
+	}
+	out, err := NewOutput(opts.Output)
+	if err != nil {
+		return nil, err
+	}
+	return executeMulti(ctx, out, cmds, script, opts)
+}
+
+// Interpreter returns the interpreter line of a script's shebang
+// ("/usr/bin/env python3", "/bin/bash -e"), defaulting to /bin/sh.
+func Interpreter(script []byte) string {
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		return "/bin/sh"
+	}
+	line := script[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	interp := strings.TrimSpace(strings.TrimSuffix(string(line), "\r"))
+	if interp == "" {
+		return "/bin/sh"
+	}
+	return interp
+}
+
+// scriptCommand builds the remote wrapper. stdin carries the script, so
+// the script itself gets /dev/null as its stdin. The interpreter runs in
+// the background so the wrapper can forward TERM/INT/HUP to it and still
+// reach its EXIT trap to delete the temp file.
+func scriptCommand(interpreter string, args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = ShellQuote(a)
+	}
+
+	return strings.Join([]string{
+		`f=$(mktemp "${TMPDIR:-/tmp}/neurader-script.XXXXXX") || exit 1`,
+		`trap 'rm -f "$f"' EXIT`,
+		`cat > "$f" || exit 1`,
+		`chmod 700 "$f"`,
+		fmt.Sprintf(`%s "$f" %s </dev/null & p=$!`, interpreter, strings.Join(quoted, " ")),
+		`trap 'kill -TERM "$p" 2>/dev/null' TERM INT HUP`,
+		`wait "$p"; rc=$?`,
+		`while kill -0 "$p" 2>/dev/null; do wait "$p"; rc=$?; done`,
+		`exit $rc`,
+	}, "\n")
+}
+
+// ShellQuote quotes s for safe use as a single POSIX shell word.
+func ShellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./=:,+@%", c)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
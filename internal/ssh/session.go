@@ -0,0 +1,348 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"neurader/internal/control"
+)
+
+/* ========================================================================
+   SESSIONS
+   runSession is the one way a command reaches a host. When a daemon is
+   running it executes the command on the daemon's pooled connection via
+   the control socket; otherwise it uses this process's pool directly.
+   ======================================================================== */
+
+const (
+	phaseKey     = "key"     // master key missing or unreadable
+	phaseConnect = "connect" // host could not be reached or authenticated
+)
+
+// exitInfo is how a session ended. Code is -1 when no exit status exists.
+type exitInfo struct {
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"`
+	Err    string `json:"error,omitempty"`
+	Phase  string `json:"phase,omitempty"`
+}
+
+// error flattens exitInfo into a Go error, nil on success.
+func (e exitInfo) error() error {
+	switch {
+	case e.Err != "":
+		return errors.New(e.Err)
+	case e.Signal != "":
+		return fmt.Errorf("killed by signal %s", e.Signal)
+	case e.Code != 0:
+		return fmt.Errorf("exited with status %d", e.Code)
+	}
+	return nil
+}
+
+type sessionSpec struct {
+	Host      HostEntry     `json:"host"`
+	Command   string        `json:"command"`
+	Subsystem string        `json:"subsystem,omitempty"` // e.g. "sftp"; replaces Command
+	Timeout   time.Duration `json:"timeout"`             // connect timeout, per attempt
+	Retry     RetryPolicy   `json:"retry"`               // connect retries
+}
+
+// daemonMode is set inside the daemon so it never proxies to itself.
+var daemonMode bool
+
+// runSession executes spec, streaming output to stdout/stderr and feeding
+// stdin (which may be nil). Cancelling ctx terminates the remote command.
+func runSession(ctx context.Context, spec sessionSpec, stdin io.Reader, stdout, stderr io.Writer) exitInfo {
+	if !daemonMode {
+		if conn, err := control.Dial(opSessionExec, spec); err == nil {
+			if info, ok := proxySession(ctx, conn, stdin, stdout, stderr); ok {
+				return info
+			}
+		}
+	}
+	return localSession(ctx, defaultPool, spec, stdin, stdout, stderr)
+}
+
+// localSession runs spec on a pooled client. On cancellation the remote
+// process is sent SIGTERM, then SIGKILL after cancelGrace, and the session
+// is closed so nothing is left running.
+func localSession(ctx context.Context, pool *Pool, spec sessionSpec, stdin io.Reader, stdout, stderr io.Writer) exitInfo {
+	client, err := pool.Get(ctx, spec.Host, spec.Timeout, spec.Retry)
+	if err != nil {
+		phase := phaseConnect
+		if errors.As(err, new(keyError)) {
+			phase = phaseKey
+		}
+		return exitInfo{Code: -1, Err: err.Error(), Phase: phase}
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		// The pooled connection went stale; redial once.
+		pool.Drop(spec.Host, client)
+		pool.Release(spec.Host)
+		if client, err = pool.Get(ctx, spec.Host, spec.Timeout, spec.Retry); err != nil {
+			return exitInfo{Code: -1, Err: err.Error(), Phase: phaseConnect}
+		}
+		if session, err = client.NewSession(); err != nil {
+			pool.Release(spec.Host)
+			return exitInfo{Code: -1, Err: fmt.Sprintf("session error: %v", err)}
+		}
+	}
+	defer pool.Release(spec.Host)
+	defer session.Close()
+
+	if spec.Subsystem != "" {
+		return subsystemSession(ctx, session, spec.Subsystem, stdin, stdout, stderr)
+	}
+
+	session.Stdout, session.Stderr = stdout, stderr
+	if stdin != nil {
+		// Pump stdin ourselves: session.Wait would otherwise block on a
+		// stdin source that never reaches EOF.
+		w, err := session.StdinPipe()
+		if err != nil {
+			return exitInfo{Code: -1, Err: fmt.Sprintf("session error: %v", err)}
+		}
+		go func() {
+			io.Copy(w, stdin)
+			w.Close()
+		}()
+	}
+
+	if err := session.Start(spec.Command); err != nil {
+		return exitInfo{Code: -1, Err: fmt.Sprintf("start failed: %v", err)}
+	}
+
+	waitDone := make(chan error, 1)
+	go func() { waitDone <- session.Wait() }()
+
+	var waitErr error
+	select {
+	case waitErr = <-waitDone:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		select {
+		case waitErr = <-waitDone:
+		case <-time.After(cancelGrace):
+			_ = session.Signal(ssh.SIGKILL)
+			session.Close()
+			waitErr = <-waitDone
+		}
+	}
+	return toExitInfo(waitErr)
+}
+
+// subsystemSession serves a subsystem such as sftp. The ssh package never
+// "starts" subsystem sessions, so Wait cannot be used: the stream is
+// copied by hand and the session is over when the remote closes stdout.
+func subsystemSession(ctx context.Context, session *ssh.Session, name string, stdin io.Reader, stdout, stderr io.Writer) exitInfo {
+	w, err := session.StdinPipe()
+	if err != nil {
+		return exitInfo{Code: -1, Err: fmt.Sprintf("session error: %v", err)}
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return exitInfo{Code: -1, Err: fmt.Sprintf("session error: %v", err)}
+	}
+	e, err := session.StderrPipe()
+	if err != nil {
+		return exitInfo{Code: -1, Err: fmt.Sprintf("session error: %v", err)}
+	}
+	if err := session.RequestSubsystem(name); err != nil {
+		return exitInfo{Code: -1, Err: fmt.Sprintf("start failed: %v", err)}
+	}
+
+	if stdin != nil {
+		go func() {
+			io.Copy(w, stdin)
+			w.Close()
+		}()
+	}
+	go io.Copy(stderr, e)
+	copyDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdout, r)
+		copyDone <- err
+	}()
+
+	select {
+	case err = <-copyDone:
+	case <-ctx.Done():
+		session.Close()
+		err = <-copyDone
+	}
+	if err != nil {
+		return exitInfo{Code: -1, Err: err.Error()}
+	}
+	return exitInfo{Code: 0}
+}
+
+// toExitInfo interprets the error returned by session.Wait.
+func toExitInfo(err error) exitInfo {
+	var exitErr *ssh.ExitError
+	var missing *ssh.ExitMissingError
+	switch {
+	case err == nil:
+		return exitInfo{Code: 0}
+	case errors.As(err, &exitErr):
+		if exitErr.Signal() != "" {
+			return exitInfo{Code: -1, Signal: exitErr.Signal()}
+		}
+		return exitInfo{Code: exitErr.ExitStatus()}
+	case errors.As(err, &missing):
+		return exitInfo{Code: -1, Err: "session ended without an exit status"}
+	}
+	return exitInfo{Code: -1, Err: err.Error()}
+}
+
+/* =========================
+   DAEMON PROXY
+========================= */
+
+const opSessionExec = "ssh.exec"
+
+// Frame types for the ssh.exec operation.
+const (
+	frameAccepted byte = 'a' // daemon -> cli: request accepted, send stdin
+	frameStdin    byte = 'i' // cli -> daemon
+	frameStdinEOF byte = 'e' // cli -> daemon
+	frameCancel   byte = 'c' // cli -> daemon: terminate the remote command
+	frameStdout   byte = 'o' // daemon -> cli
+	frameStderr   byte = 'r' // daemon -> cli
+	frameExit     byte = 'x' // daemon -> cli: JSON exitInfo
+)
+
+// proxySession runs a session through the daemon. ok is false when the
+// daemon refused the request before anything was sent, in which case the
+// caller should fall back to a local session.
+func proxySession(ctx context.Context, conn *control.Conn, stdin io.Reader, stdout, stderr io.Writer) (exitInfo, bool) {
+	defer conn.Close()
+
+	typ, _, err := conn.ReadFrame()
+	if err != nil || typ != frameAccepted {
+		return exitInfo{}, false
+	}
+
+	go func() {
+		if stdin != nil {
+			io.Copy(control.FrameWriter{Conn: conn, Type: frameStdin}, stdin)
+		}
+		conn.WriteFrame(frameStdinEOF, nil)
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.WriteFrame(frameCancel, nil)
+			// The daemon escalates to SIGKILL itself; only give up on it
+			// if it stops answering entirely.
+			select {
+			case <-time.After(cancelGrace + 5*time.Second):
+				conn.Close()
+			case <-done:
+			}
+		case <-done:
+		}
+	}()
+
+	for {
+		typ, data, err := conn.ReadFrame()
+		if err != nil {
+			return exitInfo{Code: -1, Err: "lost connection to daemon"}, true
+		}
+		switch typ {
+		case frameStdout:
+			stdout.Write(data)
+		case frameStderr:
+			stderr.Write(data)
+		case frameExit:
+			var info exitInfo
+			if err := json.Unmarshal(data, &info); err != nil {
+				return exitInfo{Code: -1, Err: "malformed exit from daemon"}, true
+			}
+			return info, true
+		}
+	}
+}
+
+// ServeSessions makes this process the daemon: sessions run on the shared
+// pool, kept warm with keepalives, and are offered on the control socket.
+func ServeSessions() {
+	daemonMode = true
+	go defaultPool.Keepalive(30*time.Second, 10*time.Minute)
+	control.Handle(opSessionExec, serveSession)
+}
+
+func serveSession(conn *control.Conn, body json.RawMessage) {
+	var spec sessionSpec
+	if err := json.Unmarshal(body, &spec); err != nil {
+		conn.WriteJSON(control.FrameError, control.ErrorBody{Error: err.Error()})
+		return
+	}
+	if err := conn.WriteFrame(frameAccepted, nil); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdinR, stdinW := io.Pipe()
+
+	// Stdin is queued to its own writer so a remote command that is slow
+	// to read never stops us from seeing a cancel frame.
+	stdinQueue := make(chan []byte, 64)
+	go func() {
+		for data := range stdinQueue {
+			if _, err := stdinW.Write(data); err != nil {
+				break
+			}
+		}
+		stdinW.Close()
+		for range stdinQueue {
+		}
+	}()
+
+	go func() {
+		eof := false
+		closeStdin := func() {
+			if !eof {
+				eof = true
+				close(stdinQueue)
+			}
+		}
+		defer closeStdin()
+		for {
+			typ, data, err := conn.ReadFrame()
+			if err != nil {
+				// The CLI went away: don't leave its command running.
+				cancel()
+				return
+			}
+			switch typ {
+			case frameStdin:
+				if !eof {
+					stdinQueue <- data
+				}
+			case frameStdinEOF:
+				closeStdin()
+			case frameCancel:
+				cancel()
+			}
+		}
+	}()
+
+	info := localSession(ctx, defaultPool, spec, stdinR,
+		control.FrameWriter{Conn: conn, Type: frameStdout},
+		control.FrameWriter{Conn: conn, Type: frameStderr})
+	stdinR.Close()
+	conn.WriteJSON(frameExit, info)
+}
@@ -0,0 +1,94 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"neurader/internal/inventory"
+)
+
+/* =========================
+   COMMAND TEMPLATING
+========================= */
+
+// RenderedCommand is the per-host result of rendering a command template.
+type RenderedCommand struct {
+	Host    HostEntry
+	Command string
+	Stdin   []byte // fed to this host's command instead of any shared stdin
+	Err     error
+}
+
+// RenderMulti resolves targets against the inventory and renders command
+// once per host. Template errors are reported per host so one missing
+// variable does not block the rest of the fleet.
+func RenderMulti(targets []string, command string, templated bool) ([]RenderedCommand, error) {
+	inv := loadInventory()
+	hosts, err := inv.Resolve(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts matched %v", targets)
+	}
+
+	var tmpl *template.Template
+	if templated {
+		// missingkey=error so "{{.vars.service}}" fails loudly instead of
+		// running "systemctl restart <no value>" on the host.
+		tmpl, err = template.New("command").Option("missingkey=error").Parse(command)
+		if err != nil {
+			return nil, fmt.Errorf("invalid command template: %v", err)
+		}
+	}
+
+	out := make([]RenderedCommand, 0, len(hosts))
+	for _, h := range hosts {
+		rc := RenderedCommand{Host: h, Command: command}
+		if tmpl != nil {
+			rc.Command, rc.Err = renderFor(tmpl, inv, h)
+		}
+		out = append(out, rc)
+	}
+	return out, nil
+}
+
+// TemplateData exposes a host to command templates as .alias, .ip,
+// .groups, .facts and .vars.
+func TemplateData(inv inventory.Inventory, h HostEntry) map[string]interface{} {
+	facts := h.Facts
+	if facts == nil {
+		facts = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"alias":  h.Name,
+		"ip":     h.IP,
+		"groups": inv.GroupsOf(h),
+		"facts":  facts,
+		"vars":   inv.VarsFor(h),
+	}
+}
+
+func renderFor(tmpl *template.Template, inv inventory.Inventory, h HostEntry) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, TemplateData(inv, h)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Render executes text as a template against data built by the caller
+// (usually TemplateData plus extra vars). Missing keys are errors, as
+// for command templates.
+func Render(text string, data map[string]interface{}) (string, error) {
+	tmpl, err := template.New("template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,434 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"neurader/internal/inventory"
+)
+
+/* ========================================================================
+   FILE TRANSFER
+   copy pushes a local file to many hosts, fetch pulls a remote file from
+   many hosts. Uploads move over SFTP on the pooled connection; the final
+   placement (mode, owner, become) is a small shell step so destinations
+   owned by root or a service user work. Downloads stream through one
+   shell command that also checksums what it sent. Every transfer is
+   verified by SHA-256.
+   ======================================================================== */
+
+type CopyOptions struct {
+	Mode   os.FileMode // 0 keeps the local file's permissions
+	Owner  string      // "user" or "user:group"; empty leaves ownership alone
+	Become Become      // place the file as another user
+}
+
+type FetchOptions struct {
+	Become Become // read the file as another user
+}
+
+// SplitRemoteSpec splits "targets:/remote/path" into its parts. The split
+// happens at the first ":/" or ":~" so IPv6 targets ("::1:/etc/hosts" or
+// "[::1]:/etc/hosts") keep their colons; otherwise at the last ':'.
+func SplitRemoteSpec(spec string) ([]string, string, error) {
+	i := strings.Index(spec, ":/")
+	if j := strings.Index(spec, ":~"); i < 0 || (j >= 0 && j < i) {
+		i = j
+	}
+	if i < 0 {
+		i = strings.LastIndex(spec, ":")
+	}
+	if i <= 0 || i == len(spec)-1 {
+		return nil, "", fmt.Errorf("expected <targets>:<remote path>, got %q", spec)
+	}
+	return strings.Split(spec[:i], ","), spec[i+1:], nil
+}
+
+// CopyToHosts uploads localPath to remotePath on every target.
+func CopyToHosts(ctx context.Context, targets []string, localPath, remotePath string, copts CopyOptions, opts RunOptions) ([]Result, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory; only files can be copied", localPath)
+	}
+	sum, err := fileSHA256(localPath)
+	if err != nil {
+		return nil, err
+	}
+	if copts.Mode == 0 {
+		copts.Mode = info.Mode().Perm()
+	}
+
+	hosts, err := loadInventory().Resolve(targets)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("copy %s -> %s", localPath, remotePath)
+	return transferMulti(ctx, hosts, label, opts, func(ctx context.Context, out Output, h HostEntry) error {
+		dest, err := uploadFile(ctx, h, localPath, filepath.Base(localPath), remotePath, sum, copts, opts.Retry)
+		if err != nil {
+			return err
+		}
+		out.Line(h, "stdout", fmt.Sprintf("copied %d bytes to %s (sha256 %s verified)", info.Size(), dest, sum[:12]))
+		return nil
+	})
+}
+
+// FetchFromHosts downloads remotePath from every target into
+// localDir/<alias>/<basename>.
+func FetchFromHosts(ctx context.Context, targets []string, remotePath, localDir string, fopts FetchOptions, opts RunOptions) ([]Result, error) {
+	hosts, err := loadInventory().Resolve(targets)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("fetch %s -> %s", remotePath, localDir)
+	return transferMulti(ctx, hosts, label, opts, func(ctx context.Context, out Output, h HostEntry) error {
+		dest := filepath.Join(localDir, safeName(h.Name), path.Base(remotePath))
+		n, sum, err := downloadFile(ctx, h, remotePath, dest, fopts, opts.Retry)
+		if err != nil {
+			return err
+		}
+		out.Line(h, "stdout", fmt.Sprintf("fetched %d bytes to %s (sha256 %s verified)", n, dest, sum[:12]))
+		return nil
+	})
+}
+
+// transferMulti drives a per-host transfer through the normal batching,
+// timeout and output machinery.
+func transferMulti(ctx context.Context, hosts []HostEntry, label string, opts RunOptions, fn func(context.Context, Output, HostEntry) error) ([]Result, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts matched")
+	}
+	out, err := NewOutput(opts.Output)
+	if err != nil {
+		return nil, err
+	}
+	out.Info("[*] Transferring on %d host(s)", len(hosts))
+	st := inventory.LoadState()
+
+	run := func(i int) Result {
+		h := hosts[i]
+		if err := opts.circuitOpen(st, h); err != nil {
+			res := Result{Host: h, Command: label, ExitCode: -1, Skipped: true, Err: err}
+			out.Finish(res)
+			return res
+		}
+		hostCtx := ctx
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			hostCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+
+		out.Start(h)
+		start := time.Now()
+		res := Result{Host: h, Command: label, ExitCode: 0}
+		if err := fn(hostCtx, out, h); err != nil {
+			res.ExitCode, res.Err = -1, err
+			if hostCtx.Err() != nil {
+				res.Cancelled, res.Err = true, cancelReason(hostCtx)
+			}
+		}
+		res.Duration = time.Since(start)
+		out.Finish(res)
+		return res
+	}
+	skip := func(i int, reason error) Result {
+		return Result{Host: hosts[i], Command: label, ExitCode: -1, Skipped: true, Err: reason}
+	}
+
+	results, err := runBatches(ctx, out, len(hosts), opts, run, skip)
+	if err != nil {
+		return nil, err
+	}
+	out.Close(results)
+	return results, nil
+}
+
+// withSFTP opens an SFTP session to host for the duration of fn and
+// records the contact in state.yml.
+func withSFTP(ctx context.Context, h HostEntry, retry RetryPolicy, fn func(*sftp.Client) error) error {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan exitInfo, 1)
+	go func() {
+		spec := sessionSpec{Host: h, Subsystem: "sftp", Timeout: 10 * time.Second, Retry: retry}
+		info := runSession(ctx, spec, inR, outW, io.Discard)
+		outW.CloseWithError(io.EOF)
+		inR.Close()
+		done <- info
+	}()
+
+	client, err := sftp.NewClientPipe(outR, inW)
+	if err != nil {
+		inW.Close()
+		info := <-done
+		switch {
+		case info.Phase == phaseConnect && ctx.Err() == nil:
+			inventory.MarkError(h, errors.New(info.Err))
+			fallthrough
+		case info.Phase != "":
+			return fmt.Errorf("connection failed: %s", info.Err)
+		}
+		return fmt.Errorf("sftp unavailable: %v", err)
+	}
+	inventory.MarkSeen(h)
+	fnErr := fn(client)
+	client.Close()
+	<-done
+	return fnErr
+}
+
+// uploadFile sends the file to a private temp path over SFTP, then moves
+// it into place with the requested mode/owner and checks the checksum of
+// the final file. It returns the resolved destination path.
+func uploadFile(ctx context.Context, h HostEntry, localPath, base, remotePath, sum string, copts CopyOptions, retry RetryPolicy) (string, error) {
+	token := randomHex(8)
+	tmp := "/tmp/.neurader-upload-" + token
+
+	err := withSFTP(ctx, h, retry, func(c *sftp.Client) error {
+		src, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := c.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+		if err != nil {
+			return fmt.Errorf("remote temp file: %v", err)
+		}
+		if err := dst.Chmod(0600); err != nil {
+			dst.Close()
+			return err
+		}
+		if _, err := dst.ReadFrom(src); err != nil {
+			dst.Close()
+			c.Remove(tmp)
+			return fmt.Errorf("upload: %v", err)
+		}
+		return dst.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The placement step runs as the become user and reads the upload on
+	// stdin, since that user usually cannot open our private temp file.
+	place := []string{
+		"d=" + ShellQuote(remotePath),
+		`case "$d" in "~") d="$HOME" ;; "~/"*) d="$HOME/${d#"~/"}" ;; esac`,
+		`case "$d" in */) d="$d"` + ShellQuote(base) + ` ;; *) if [ -d "$d" ]; then d="$d/"` + ShellQuote(base) + `; fi ;; esac`,
+		`n="$d.neurader-` + token + `"`,
+		`cat > "$n" || { rm -f "$n"; exit 1; }`,
+		fmt.Sprintf(`chmod %o "$n" || { rm -f "$n"; exit 1; }`, copts.Mode),
+	}
+	if copts.Owner != "" {
+		place = append(place, fmt.Sprintf(`chown %s "$n" || { rm -f "$n"; exit 1; }`, ShellQuote(copts.Owner)))
+	}
+	place = append(place,
+		`mv -f "$n" "$d" || { rm -f "$n"; exit 1; }`,
+		`printf '%s %s\n' "$(sha256sum < "$d" | cut -d' ' -f1)" "$d"`,
+	)
+	inner := strings.Join(place, "\n")
+	if !copts.Become.Enabled() {
+		inner = "sh -c " + ShellQuote(inner)
+	} else {
+		inner = copts.Become.wrapPlain(inner)
+	}
+	script := strings.Join([]string{
+		"t=" + ShellQuote(tmp),
+		`trap 'rm -f "$t"' EXIT`,
+		inner + ` < "$t"`,
+	}, "\n")
+
+	stdout, stderr, info := captureSession(ctx, h, script)
+	if err := info.error(); err != nil {
+		if berr := becomeError(copts.Become, info.Code, stderr); berr != nil {
+			return "", berr
+		}
+		return "", err
+	}
+	return checkUpload(stdout, sum)
+}
+
+// checkUpload compares the checksum the placement step printed with the
+// local one and returns the final remote path.
+func checkUpload(stdout, sum string) (string, error) {
+	fields := lastLineFields(stdout)
+	if len(fields) < 2 || !isSHA256(fields[0]) {
+		return "", fmt.Errorf("could not verify remote file")
+	}
+	if fields[0] != sum {
+		return "", fmt.Errorf("checksum mismatch on %s: local %s, remote %s", fields[1], sum[:12], fields[0][:12])
+	}
+	return strings.Join(fields[1:], " "), nil
+}
+
+// isSHA256 reports whether s is a hex-encoded SHA-256 digest.
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// sumMarker prefixes the checksum line the fetch script writes to stderr.
+const sumMarker = "::neurader-sum::"
+
+// fetchScript streams path on stdout from a private snapshot, then reports
+// the snapshot's checksum and the file's mode on stderr. Checksumming the
+// snapshot rather than the live file means a file that is still being
+// written (a log, say) verifies as the copy that was sent.
+func fetchScript(path string) string {
+	return strings.Join([]string{
+		"f=" + ShellQuote(path),
+		`t=$(mktemp) || exit 1`,
+		`trap 'rm -f "$t"' EXIT`,
+		`cat -- "$f" > "$t" || exit 1`,
+		`sum=$(sha256sum < "$t") || exit 1`,
+		`mode=$(stat -c %a -- "$f" 2>/dev/null)`,
+		`cat "$t" || exit 1`,
+		`echo "` + sumMarker + ` ${sum%% *} $mode" >&2`,
+	}, "\n")
+}
+
+// downloadFile pulls remotePath into dest, read as the become user if one
+// is set, hashing the bytes as they arrive and comparing them with the
+// checksum the same remote command took. dest is removed on any failure.
+func downloadFile(ctx context.Context, h HostEntry, remotePath, dest string, fopts FetchOptions, retry RetryPolicy) (n int64, sum string, err error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return 0, "", err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dest)
+		}
+	}()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(f, hash)}
+	var stderr bytes.Buffer
+	spec := sessionSpec{Host: h, Command: fopts.Become.wrapPlain(fetchScript(remotePath)), Timeout: 10 * time.Second, Retry: retry}
+	info := runSession(ctx, spec, nil, counter, &stderr)
+	remote, mode, msg := parseSumLine(stderr.Bytes())
+	if err := info.error(); err != nil {
+		if info.Phase == phaseConnect && ctx.Err() == nil {
+			inventory.MarkError(h, errors.New(info.Err))
+		}
+		if berr := becomeError(fopts.Become, info.Code, stderr.Bytes()); berr != nil {
+			return 0, "", berr
+		}
+		if msg != "" && info.Phase == "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+		return 0, "", err
+	}
+	inventory.MarkSeen(h)
+
+	local := hex.EncodeToString(hash.Sum(nil))
+	if remote == "" {
+		return 0, "", fmt.Errorf("could not verify remote checksum")
+	}
+	if remote != local {
+		return 0, "", fmt.Errorf("checksum mismatch for %s", remotePath)
+	}
+	if perm, perr := strconv.ParseUint(mode, 8, 32); perr == nil {
+		f.Chmod(os.FileMode(perm).Perm())
+	}
+	return counter.n, local, nil
+}
+
+// parseSumLine finds the fetch script's checksum line in stderr and
+// returns it split out from the rest, which is kept for error messages.
+func parseSumLine(stderr []byte) (sum, mode, rest string) {
+	var other []string
+	for _, line := range strings.Split(strings.TrimSpace(string(stderr)), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 && fields[0] == sumMarker {
+			sum = fields[1]
+			if len(fields) > 2 {
+				mode = fields[2]
+			}
+			continue
+		}
+		if line != "" {
+			other = append(other, line)
+		}
+	}
+	return sum, mode, strings.Join(other, "\n")
+}
+
+// captureSession runs a short helper command and returns its output.
+// stderr is also folded into the error on failure.
+func captureSession(ctx context.Context, h HostEntry, command string) (string, []byte, exitInfo) {
+	var stdout, stderr bytes.Buffer
+	info := runSession(ctx, sessionSpec{Host: h, Command: command, Timeout: 10 * time.Second}, nil, &stdout, &stderr)
+	if info.Err == "" && info.Code != 0 {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			info.Err = fmt.Sprintf("exited with status %d: %s", info.Code, msg)
+		}
+	}
+	return stdout.String(), stderr.Bytes(), info
+}
+
+// lastLineFields splits the last non-empty line of out, skipping anything
+// a login profile may have printed first.
+func lastLineFields(out string) []string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.Fields(lines[len(lines)-1])
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// safeName makes an alias usable as a directory name.
+func safeName(s string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_", "%", "_").Replace(s)
+}
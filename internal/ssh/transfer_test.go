@@ -0,0 +1,79 @@
+package ssh
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitRemoteSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		targets []string
+		path    string
+	}{
+		{"web1:/etc/hosts", []string{"web1"}, "/etc/hosts"},
+		{"web1,web2:/etc/hosts", []string{"web1", "web2"}, "/etc/hosts"},
+		{"@web:/var/log/syslog", []string{"@web"}, "/var/log/syslog"},
+		{"web1:~/notes.txt", []string{"web1"}, "~/notes.txt"},
+		{"web1:relative/file", []string{"web1"}, "relative/file"},
+		{"10.0.0.1:/tmp/x", []string{"10.0.0.1"}, "/tmp/x"},
+		{"::1:/etc/hosts", []string{"::1"}, "/etc/hosts"},
+		{"[::1]:/etc/hosts", []string{"[::1]"}, "/etc/hosts"},
+		{"fe80::1%eth0:/etc/hosts", []string{"fe80::1%eth0"}, "/etc/hosts"},
+		{"web1:/path/with:colon", []string{"web1"}, "/path/with:colon"},
+	}
+	for _, tt := range tests {
+		targets, path, err := SplitRemoteSpec(tt.spec)
+		if err != nil {
+			t.Errorf("SplitRemoteSpec(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(targets, tt.targets) || path != tt.path {
+			t.Errorf("SplitRemoteSpec(%q) = %q, %q, want %q, %q", tt.spec, targets, path, tt.targets, tt.path)
+		}
+	}
+}
+
+func TestSplitRemoteSpecInvalid(t *testing.T) {
+	for _, spec := range []string{"", "web1", ":/etc/hosts", "web1:"} {
+		if _, _, err := SplitRemoteSpec(spec); err == nil {
+			t.Errorf("SplitRemoteSpec(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestParseSumLine(t *testing.T) {
+	sum, mode, rest := parseSumLine([]byte("warning: one\n" + sumMarker + " abc123 640\nwarning: two\n"))
+	if sum != "abc123" || mode != "640" || rest != "warning: one\nwarning: two" {
+		t.Errorf("parseSumLine = %q, %q, %q", sum, mode, rest)
+	}
+	sum, mode, rest = parseSumLine([]byte("cat: /x: No such file or directory\n"))
+	if sum != "" || mode != "" || rest != "cat: /x: No such file or directory" {
+		t.Errorf("parseSumLine without a checksum = %q, %q, %q", sum, mode, rest)
+	}
+}
+
+func TestCheckUpload(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+	tests := []struct {
+		name, stdout, path string
+		ok                 bool
+	}{
+		{"verified", sum + " /etc/motd\n", "/etc/motd", true},
+		{"after profile noise", "Welcome!\n" + sum + " /srv/my file\n", "/srv/my file", true},
+		{"mismatch", other + " /etc/motd\n", "", false},
+		{"short token", "abc /etc/motd\n", "", false},
+		{"sha256sum error", "sha256sum: can't open: No such file\n", "", false},
+		{"not hex", strings.Repeat("zz", 32) + " /etc/motd\n", "", false},
+		{"one field", sum + "\n", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		path, err := checkUpload(tt.stdout, sum)
+		if (err == nil) != tt.ok || path != tt.path {
+			t.Errorf("%s: checkUpload = %q, %v", tt.name, path, err)
+		}
+	}
+}
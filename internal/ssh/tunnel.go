@@ -0,0 +1,368 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"neurader/internal/audit"
+	"neurader/internal/inventory"
+)
+
+/* =========================
+   PORT FORWARDING
+========================= */
+
+// Forward is one tunnel specification:
+//
+//	L:[bind:]port:host:hostport  listen locally, connect from the remote host
+//	R:[bind:]port:host:hostport  listen on the remote host, connect from here
+//	D:[bind:]port                local SOCKS5 proxy, connecting from the remote host
+//
+// Local binds default to 127.0.0.1; IPv6 addresses go in brackets.
+type Forward struct {
+	Kind   string // "L", "R" or "D"
+	Bind   string // host:port to listen on
+	Target string // host:port to connect to; empty for D
+	Spec   string // as given on the command line
+}
+
+func (f Forward) String() string {
+	if f.Kind == "D" {
+		return fmt.Sprintf("D %s (SOCKS5)", f.Bind)
+	}
+	return fmt.Sprintf("%s %s -> %s", f.Kind, f.Bind, f.Target)
+}
+
+// ParseForward parses an L:, R: or D: tunnel specification.
+func ParseForward(spec string) (Forward, error) {
+	parts := splitForward(spec)
+	f := Forward{Kind: strings.ToUpper(parts[0]), Spec: spec}
+	args := parts[1:]
+
+	bad := fmt.Errorf("invalid tunnel %q (want L:[bind:]port:host:port, R:[bind:]port:host:port or D:[bind:]port)", spec)
+	bind := "127.0.0.1"
+	if f.Kind == "R" {
+		bind = "localhost" // interpreted by the remote sshd
+	}
+	switch f.Kind {
+	case "L", "R":
+		switch len(args) {
+		case 3:
+		case 4:
+			bind, args = args[0], args[1:]
+		default:
+			return f, bad
+		}
+		if !validPort(args[0]) || !validPort(args[2]) || args[1] == "" {
+			return f, bad
+		}
+		f.Bind = net.JoinHostPort(bind, args[0])
+		f.Target = net.JoinHostPort(args[1], args[2])
+	case "D":
+		switch len(args) {
+		case 1:
+		case 2:
+			bind, args = args[0], args[1:]
+		default:
+			return f, bad
+		}
+		if !validPort(args[0]) {
+			return f, bad
+		}
+		f.Bind = net.JoinHostPort(bind, args[0])
+	default:
+		return f, bad
+	}
+	return f, nil
+}
+
+// splitForward splits on ':' outside square brackets and unwraps
+// bracketed IPv6 addresses.
+func splitForward(spec string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range spec {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, spec[start:])
+	for i, p := range parts {
+		parts[i] = strings.TrimSuffix(strings.TrimPrefix(p, "["), "]")
+	}
+	return parts
+}
+
+func validPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 0 && n <= 65535
+}
+
+// tunnelStats counts what went through a tunnel session for the audit log.
+type tunnelStats struct {
+	conns int64
+	bytes int64
+}
+
+// Tunnel opens forwards through target over the master key and keeps them
+// up until ctx ends or the connection to the host is lost. The session is
+// recorded in the audit log when it opens and closes.
+func Tunnel(ctx context.Context, target string, forwards []Forward) error {
+	host, ok := loadInventory().Find(target)
+	if !ok {
+		host = HostEntry{Name: target, IP: target}
+	}
+
+	client, err := defaultPool.Get(ctx, host, 10*time.Second, DefaultRetryPolicy())
+	if err != nil {
+		if !errors.As(err, new(keyError)) && ctx.Err() == nil {
+			inventory.MarkError(host, err)
+		}
+		return fmt.Errorf("connection failed: %v", err)
+	}
+	defer defaultPool.Release(host)
+	inventory.MarkSeen(host)
+
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	stats := &tunnelStats{}
+	var specs []string
+	for _, f := range forwards {
+		var l net.Listener
+		if f.Kind == "R" {
+			l, err = client.Listen("tcp", f.Bind)
+		} else {
+			l, err = net.Listen("tcp", f.Bind)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: cannot listen on %s: %v", f.Spec, f.Bind, err)
+		}
+		listeners = append(listeners, l)
+		specs = append(specs, f.Spec)
+
+		bound := f
+		bound.Bind = l.Addr().String()
+		fmt.Printf("[+] %s via %s\n", bound, host.Name)
+		go acceptForward(l, client, host, bound, stats)
+	}
+
+	addr := client.RemoteAddr().String()
+	start := time.Now()
+	_ = audit.Record(audit.Event{Action: "tunnel.open", Host: host.Name, Addr: addr, Forwards: specs})
+	fmt.Println("[*] Tunnel is up. Press Ctrl-C to close it.")
+
+	// The connection is gone when Wait returns or keepalives stop being
+	// answered; either ends the tunnel.
+	lost := make(chan error, 1)
+	go func() {
+		lost <- client.Wait()
+	}()
+	go keepTunnelAlive(ctx, client, lost)
+
+	var result error
+	select {
+	case <-ctx.Done():
+	case err := <-lost:
+		defaultPool.Drop(host, client)
+		result = fmt.Errorf("connection to %s lost: %v", host.Name, err)
+	}
+
+	ev := audit.Event{Action: "tunnel.close", Host: host.Name, Addr: addr, Forwards: specs,
+		Conns: int(atomic.LoadInt64(&stats.conns)), Bytes: atomic.LoadInt64(&stats.bytes),
+		Duration: time.Since(start).Round(time.Second).String()}
+	if result != nil {
+		ev.Error = result.Error()
+	}
+	_ = audit.Record(ev)
+	return result
+}
+
+func keepTunnelAlive(ctx context.Context, client *ssh.Client, lost chan<- error) {
+	t := time.NewTicker(30 * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				continue
+			}
+		case <-time.After(15 * time.Second):
+		}
+		select {
+		case lost <- errors.New("keepalive timed out"):
+		default:
+		}
+		return
+	}
+}
+
+// acceptForward serves one listener until it is closed.
+func acceptForward(l net.Listener, client *ssh.Client, host HostEntry, f Forward, stats *tunnelStats) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		atomic.AddInt64(&stats.conns, 1)
+		go func() {
+			defer conn.Close()
+			switch f.Kind {
+			case "L":
+				serveForward(conn, f.Target, host, stats, client.Dial)
+			case "R":
+				serveForward(conn, f.Target, host, stats, net.Dial)
+			case "D":
+				serveSOCKS(conn, client, host, stats)
+			}
+		}()
+	}
+}
+
+func serveForward(conn net.Conn, target string, host HostEntry, stats *tunnelStats, dial func(network, addr string) (net.Conn, error)) {
+	upstream, err := dial("tcp", target)
+	if err != nil {
+		fmt.Printf("[!] %s: %s -> %s failed: %v\n", host.Name, conn.RemoteAddr(), target, err)
+		return
+	}
+	defer upstream.Close()
+	fmt.Printf("[*] %s: %s -> %s\n", host.Name, conn.RemoteAddr(), target)
+	pipe(conn, upstream, stats)
+}
+
+// pipe copies both ways until both directions are finished, closing the
+// write side of each connection when its source reaches EOF.
+func pipe(a, b net.Conn, stats *tunnelStats) {
+	var wg sync.WaitGroup
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		n, _ := io.Copy(dst, src)
+		atomic.AddInt64(&stats.bytes, n)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go cp(a, b)
+	go cp(b, a)
+	wg.Wait()
+}
+
+/* =========================
+   SOCKS5 (D: forwards)
+========================= */
+
+// SOCKS5 reply codes.
+const (
+	socksOK              = 0x00
+	socksHostUnreach     = 0x04
+	socksCmdUnsupported  = 0x07
+	socksAddrUnsupported = 0x08
+)
+
+// serveSOCKS handles one SOCKS5 CONNECT request (RFC 1928, no auth),
+// connecting to the destination from the remote host.
+func serveSOCKS(conn net.Conn, client *ssh.Client, host HostEntry, stats *tunnelStats) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// Greeting: version, methods. Only "no authentication" is offered.
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil || hdr[0] != 5 {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, hdr[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Request: version, command, reserved, address type, address, port.
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[0] != 5 {
+		return
+	}
+	var dstHost string
+	switch req[3] {
+	case 1, 4:
+		ip := make([]byte, 4)
+		if req[3] == 4 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		dstHost = net.IP(ip).String()
+	case 3:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		dstHost = string(name)
+	default:
+		socksReply(conn, socksAddrUnsupported)
+		return
+	}
+	portBuf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBuf); err != nil {
+		return
+	}
+	if req[1] != 1 { // CONNECT
+		socksReply(conn, socksCmdUnsupported)
+		return
+	}
+	target := net.JoinHostPort(dstHost, strconv.Itoa(int(binary.BigEndian.Uint16(portBuf))))
+
+	upstream, err := client.Dial("tcp", target)
+	if err != nil {
+		fmt.Printf("[!] %s: SOCKS %s -> %s failed: %v\n", host.Name, conn.RemoteAddr(), target, err)
+		socksReply(conn, socksHostUnreach)
+		return
+	}
+	defer upstream.Close()
+	socksReply(conn, socksOK)
+	conn.SetDeadline(time.Time{})
+	fmt.Printf("[*] %s: SOCKS %s -> %s\n", host.Name, conn.RemoteAddr(), target)
+	pipe(conn, upstream, stats)
+}
+
+func socksReply(conn net.Conn, code byte) {
+	conn.Write([]byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0})
+}
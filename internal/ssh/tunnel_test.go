@@ -0,0 +1,54 @@
+package ssh
+
+import "testing"
+
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		spec   string
+		kind   string
+		bind   string
+		target string
+	}{
+		{"L:8080:localhost:80", "L", "127.0.0.1:8080", "localhost:80"},
+		{"l:8080:db:5432", "L", "127.0.0.1:8080", "db:5432"},
+		{"L:0.0.0.0:8080:10.0.0.5:80", "L", "0.0.0.0:8080", "10.0.0.5:80"},
+		{"L:[::1]:8080:[2001:db8::5]:80", "L", "[::1]:8080", "[2001:db8::5]:80"},
+		{"R:9000:localhost:3000", "R", "localhost:9000", "localhost:3000"},
+		{"R:0.0.0.0:9000:127.0.0.1:3000", "R", "0.0.0.0:9000", "127.0.0.1:3000"},
+		// Port 0 binds an ephemeral port; the real one is reported.
+		{"L:0:localhost:80", "L", "127.0.0.1:0", "localhost:80"},
+		{"D:1080", "D", "127.0.0.1:1080", ""},
+		{"D:[::1]:1080", "D", "[::1]:1080", ""},
+	}
+	for _, tt := range tests {
+		f, err := ParseForward(tt.spec)
+		if err != nil {
+			t.Errorf("ParseForward(%q): %v", tt.spec, err)
+			continue
+		}
+		if f.Kind != tt.kind || f.Bind != tt.bind || f.Target != tt.target || f.Spec != tt.spec {
+			t.Errorf("ParseForward(%q) = %+v, want %s %s -> %s", tt.spec, f, tt.kind, tt.bind, tt.target)
+		}
+	}
+}
+
+func TestParseForwardInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"8080:localhost:80",
+		"X:8080:localhost:80",
+		"L:8080",
+		"L:8080:localhost",
+		"L:65536:localhost:80",
+		"L:http:localhost:80",
+		"L:8080::80",
+		"L:a:b:8080:localhost:80",
+		"D",
+		"D:x",
+		"D:a:b:1080",
+	} {
+		if f, err := ParseForward(spec); err == nil {
+			t.Errorf("ParseForward(%q) = %+v, expected an error", spec, f)
+		}
+	}
+}
@@ -42,8 +42,9 @@ func UpdateAllChildren() {
 				"sudo chmod +x /usr/local/bin/neurader && " +
 				"sudo systemctl restart neurader"
 
-			// ExecuteRemoteWithInput (defined in executor.go)
-			err := ExecuteRemoteWithInput(host.IP, updateCmd, binaryData)
+			// executeWithInput (defined in executor.go) dials through
+			// the host's jump host when it declares one
+			err := executeWithInput(host, updateCmd, binaryData)
 			if err != nil {
 				fmt.Printf("[%s] %sUpdate Failed%s: %v\n", host.Name, ColorRed, ColorReset, err)
 			} else {
@@ -0,0 +1,101 @@
+package system
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+/* ========================================================================
+   NODE IDENTITY
+   Every child owns a persistent ed25519 keypair generated at install. Its
+   node ID is derived from the public key, so a jumpbox can recognise a
+   node across DHCP changes and re-IPs, and nobody can claim an ID without
+   holding the matching private key.
+   ======================================================================== */
+
+const NodeKeyPath = "/etc/neurader/node.key"
+
+type NodeIdentity struct {
+	ID     string
+	Public ed25519.PublicKey
+	key    ed25519.PrivateKey
+}
+
+// NodeIDFor derives the node ID for a public key.
+func NodeIDFor(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:16])
+}
+
+// EnsureNodeIdentity loads the node keypair, generating it on first use.
+func EnsureNodeIdentity() (*NodeIdentity, error) {
+	data, err := os.ReadFile(NodeKeyPath)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil || len(block.Bytes) != ed25519.SeedSize {
+			return nil, fmt.Errorf("corrupt node key at %s", NodeKeyPath)
+		}
+		return newIdentity(ed25519.NewKeyFromSeed(block.Bytes)), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(ConfigDir, 0755); err != nil {
+		return nil, err
+	}
+	block := &pem.Block{Type: "NEURADER NODE KEY", Bytes: priv.Seed()}
+	if err := os.WriteFile(NodeKeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("could not write %s: %v", NodeKeyPath, err)
+	}
+	return newIdentity(priv), nil
+}
+
+func newIdentity(priv ed25519.PrivateKey) *NodeIdentity {
+	pub := priv.Public().(ed25519.PublicKey)
+	return &NodeIdentity{ID: NodeIDFor(pub), Public: pub, key: priv}
+}
+
+// PublicKeyString is the base64 public key as stored in the inventory.
+func (n *NodeIdentity) PublicKeyString() string {
+	return base64.StdEncoding.EncodeToString(n.Public)
+}
+
+// Sign signs msg with the node's private key, base64 encoded.
+func (n *NodeIdentity) Sign(msg []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(n.key, msg))
+}
+
+// VerifyNodeSignature checks sig over msg against a base64 public key and
+// that the key really belongs to nodeID.
+func VerifyNodeSignature(nodeID, pubKey, sig string, msg []byte) error {
+	pub, err := base64.StdEncoding.DecodeString(pubKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("malformed node public key")
+	}
+	if NodeIDFor(pub) != nodeID {
+		return fmt.Errorf("node ID does not match its public key")
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || !ed25519.Verify(pub, msg, rawSig) {
+		return fmt.Errorf("invalid node signature")
+	}
+	return nil
+}
+
+// RegistrationMessage is the payload a child signs when registering. The
+// nonce is issued by the jumpbox for this one registration, so a captured
+// request cannot be replayed.
+func RegistrationMessage(nodeID, hostname string, ts int64, nonce string) []byte {
+	return []byte(fmt.Sprintf("neurader-register|%s|%s|%d|%s", nodeID, hostname, ts, nonce))
+}